@@ -1,25 +1,28 @@
+// Keeps rand.Seed effective on Go 1.24 and later, for seeded games
+//go:debug randseednop=0
+
 package main
 
 import (
 	"fmt"
-	"math/rand"
 	"os"
-	"time"
 
 	"github.com/urfave/cli"
 	bettererrors "github.com/xtuc/better-errors"
 
 	"github.com/bytearena/core/common/utils"
 
+	agentcmd "github.com/bytearena/ba/subcommand/agent"
 	"github.com/bytearena/ba/subcommand/build"
 	"github.com/bytearena/ba/subcommand/generate"
+	"github.com/bytearena/ba/subcommand/lint"
 	mapcmd "github.com/bytearena/ba/subcommand/map"
+	"github.com/bytearena/ba/subcommand/replay"
+	"github.com/bytearena/ba/subcommand/tournament"
 	"github.com/bytearena/ba/subcommand/train"
 )
 
 func main() {
-	rand.Seed(time.Now().UnixNano())
-
 	app := makeapp()
 	app.Version = utils.GetVersion()
 	app.Run(os.Args)
@@ -41,10 +44,20 @@ func makeapp() *cli.App {
 			},
 		},
 		{
-			Name:  "build",
-			Usage: "Build an agent",
+			Name:      "build",
+			Usage:     "Build one or more agents",
+			ArgsUsage: "[directory or glob...]",
 			Flags: []cli.Flag{
 				cli.BoolFlag{Name: "watch", Usage: "Enable watch mode"},
+				cli.BoolFlag{Name: "force", Usage: "Build even if nothing changed since the last build"},
+				cli.StringSliceFlag{Name: "build-arg", Usage: "Build argument, as KEY=VALUE or KEY to take it from the environment"},
+				cli.StringFlag{Name: "target", Value: "", Usage: "Stage of a multi-stage Dockerfile to build; the image is tagged <agent>:<target> unless --tag is given"},
+				cli.BoolFlag{Name: "no-cache", Usage: "Do not use the Docker cache when building"},
+				cli.BoolFlag{Name: "pull", Usage: "Always pull newer versions of the base images"},
+				cli.StringSliceFlag{Name: "tag", Usage: "Tag of a variant of the agent, e.g. my-agent:debug; the image of the agent itself is left as is"},
+				cli.IntFlag{Name: "jobs, j", Value: build.BUILD_DEFAULT_JOBS, Usage: "Number of agents built concurrently"},
+				cli.StringFlag{Name: "output", Value: build.OUTPUT_TEXT, Usage: "Format of the build results: text or json (the logs then go to stderr)"},
+				cli.BoolFlag{Name: "plain", Usage: "Log without emojis nor cursor movements, e.g. for CI"},
 			},
 			BashComplete: func(c *cli.Context) {
 				completion, err := build.BashComplete(c.Args().Get(0))
@@ -58,9 +71,18 @@ func makeapp() *cli.App {
 			Action: func(c *cli.Context) error {
 				args := build.Arguments{
 					WatchMode: c.Bool("watch"),
+					Force:     c.Bool("force"),
+					BuildArgs: c.StringSlice("build-arg"),
+					Target:    c.String("target"),
+					NoCache:   c.Bool("no-cache"),
+					Pull:      c.Bool("pull"),
+					Tags:      c.StringSlice("tag"),
+					Jobs:      c.Int("jobs"),
+					Output:    c.String("output"),
+					Plain:     c.Bool("plain"),
 				}
 
-				showUsage, err := build.Main(c.Args().Get(0), args)
+				showUsage, err := build.MainMany(c.Args(), args)
 
 				if err != nil {
 					commandFailWith("build", showUsage, c, err)
@@ -69,6 +91,32 @@ func makeapp() *cli.App {
 				return nil
 			},
 		},
+		{
+			Name:      "lint",
+			Usage:     "Check the Dockerfile of an agent",
+			ArgsUsage: "[directory]",
+			BashComplete: func(c *cli.Context) {
+				completion, err := build.BashComplete(c.Args().Get(0))
+
+				if err != nil {
+					commandFailWith("lint", false, c, err)
+				}
+
+				fmt.Fprintln(c.App.Writer, completion)
+			},
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "output", Value: lint.OUTPUT_TEXT, Usage: "Format of the findings: text or json"},
+			},
+			Action: func(c *cli.Context) error {
+				showUsage, err := lint.Main(c.Args().Get(0), c.String("output"))
+
+				if err != nil {
+					commandFailWith("lint", showUsage, c, err)
+				}
+
+				return nil
+			},
+		},
 		{
 			Name:    "generate",
 			Aliases: []string{"gen"},
@@ -96,7 +144,17 @@ func makeapp() *cli.App {
 			Name:    "train",
 			Aliases: []string{"t"},
 			Usage:   "Train your agent",
+			BashComplete: func(c *cli.Context) {
+				completion, err := agentcmd.BashComplete()
+
+				if err != nil {
+					commandFailWith("train", false, c, err)
+				}
+
+				fmt.Fprintln(c.App.Writer, completion)
+			},
 			Flags: []cli.Flag{
+				cli.StringFlag{Name: "config", Value: "", Usage: "Train config file; flags take precedence over it (default: " + train.TRAIN_CONFIG_FILENAME + " if present)"},
 				cli.IntFlag{Name: "tps", Value: 20, Usage: "Number of ticks per second"},
 				cli.StringFlag{Name: "host", Value: "", Usage: "IP serving the trainer; required"},
 				cli.StringSliceFlag{Name: "agent", Usage: "Agent images"},
@@ -104,12 +162,19 @@ func makeapp() *cli.App {
 				cli.IntFlag{Name: "port", Value: 8080, Usage: "Port serving the trainer"},
 				cli.StringFlag{Name: "viz-host", Value: "127.0.0.1", Usage: "Specify a host for the visualization server"},
 				cli.StringFlag{Name: "record-file", Value: "", Usage: "Destination file for recording the game"},
-				cli.StringFlag{Name: "map", Value: "hexagon", Usage: "Name of the map used by the trainer"},
+				cli.StringFlag{Name: "map", Value: "hexagon", Usage: "Name of the map used by the trainer, or path to a local map directory or zip; a local map is loaded again by each headless match, otherwise when ba train restarts"},
 				cli.BoolFlag{Name: "no-browser", Usage: "Disable automatic browser opening at start"},
 				cli.BoolFlag{Name: "debug", Usage: "Enable debug logging"},
 				cli.BoolFlag{Name: "quiet", Usage: "Decrease verbosity of the output"},
 				cli.BoolFlag{Name: "profile", Usage: "Enable execution profiling"},
 				cli.IntFlag{Name: "duration", Usage: "If set, game will stop after this durarion (in seconds)"},
+				cli.BoolFlag{Name: "headless", Usage: "Run without visualization and write a report of the results; requires --duration"},
+				cli.IntFlag{Name: "matches", Value: 1, Usage: "Number of matches to run back to back in headless mode"},
+				cli.StringFlag{Name: "report", Value: "", Usage: "Destination file for the headless report (default: stdout)"},
+				cli.StringFlag{Name: "output", Value: "text", Usage: "Format of the events output: text or json (one object per line)"},
+				cli.StringFlag{Name: "output-file", Value: "", Usage: "Destination file for the json events output (default: stdout)"},
+				cli.Int64Flag{Name: "seed", Usage: "Seed of the game, to reproduce a previous run; random if not set"},
+				cli.StringFlag{Name: "report-format", Value: "", Usage: "Format of the headless report: json or csv (default: guessed from the report file extension)"},
 			},
 			Action: func(c *cli.Context) error {
 
@@ -127,6 +192,30 @@ func makeapp() *cli.App {
 					IsQuiet:            c.Bool("quiet"),
 					ShouldProfile:      c.Bool("profile"),
 					DurationSeconds:    c.Int("duration"),
+					Headless:           c.Bool("headless"),
+					Matches:            c.Int("matches"),
+					ReportFile:         c.String("report"),
+					ReportFormat:       c.String("report-format"),
+					Seed:               c.Int64("seed"),
+					SeedSet:            c.IsSet("seed"),
+					Output:             c.String("output"),
+					OutputFile:         c.String("output-file"),
+				}
+
+				configFile := c.String("config")
+
+				if configFile == "" {
+					configFile, _ = train.FindTrainConfig()
+				}
+
+				if configFile != "" {
+					config, err := train.LoadTrainConfig(configFile)
+
+					if err != nil {
+						commandFailWith("train", false, c, err)
+					}
+
+					config.Apply(&args, c.IsSet)
 				}
 
 				showUsage, err := train.TrainAction(args)
@@ -138,6 +227,84 @@ func makeapp() *cli.App {
 				return nil
 			},
 		},
+		{
+			Name:      "replay",
+			Usage:     "Play back a recorded game in the visualization",
+			ArgsUsage: "<record file>",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "map", Value: "", Usage: "Name of the map of the record (default: read from the record metadata)"},
+				cli.IntFlag{Name: "tps", Value: 0, Usage: "Number of ticks per second of the record (default: read from the record metadata)"},
+				cli.Float64Flag{Name: "speed", Value: 1, Usage: "Initial playback speed"},
+				cli.IntFlag{Name: "port", Value: 8080, Usage: "Port serving the visualization"},
+				cli.IntFlag{Name: "controls-port", Value: 0, Usage: "Port serving the visualization with its playback controls (default: --port + 1)"},
+				cli.StringFlag{Name: "viz-host", Value: "127.0.0.1", Usage: "Specify a host for the visualization server"},
+				cli.BoolFlag{Name: "no-browser", Usage: "Disable automatic browser opening at start"},
+			},
+			Action: func(c *cli.Context) error {
+				args := replay.ReplayActionArguments{
+					RecordFile:  c.Args().Get(0),
+					MapName:     c.String("map"),
+					Tps:         c.Int("tps"),
+					Speed:       c.Float64("speed"),
+					Vizport:     c.Int("port"),
+					Vizhost:     c.String("viz-host"),
+					Controlport: c.Int("controls-port"),
+					Nobrowser:   c.Bool("no-browser"),
+				}
+
+				showUsage, err := replay.ReplayAction(args)
+
+				if err != nil {
+					commandFailWith("replay", showUsage, c, err)
+				}
+
+				return nil
+			},
+		},
+		{
+			Name:  "tournament",
+			Usage: "Rank agents in a round-robin tournament",
+			Flags: []cli.Flag{
+				cli.IntFlag{Name: "tps", Value: 20, Usage: "Number of ticks per second"},
+				cli.StringFlag{Name: "host", Value: "", Usage: "IP serving the trainer; required"},
+				cli.StringSliceFlag{Name: "agent", Usage: "Agent images"},
+				cli.StringSliceFlag{Name: "map", Usage: "Names of the maps used by the tournament (default: hexagon)"},
+				cli.IntFlag{Name: "group-size", Value: 2, Usage: "Number of agents in each match"},
+				cli.IntFlag{Name: "rounds", Value: 1, Usage: "Number of times each group plays on each map"},
+				cli.IntFlag{Name: "duration", Value: 60, Usage: "Duration of each match (in seconds)"},
+				cli.StringFlag{Name: "report", Value: "", Usage: "Destination file for the JSON report of the tournament"},
+				cli.BoolFlag{Name: "debug", Usage: "Enable debug logging"},
+				cli.BoolFlag{Name: "quiet", Usage: "Decrease verbosity of the output"},
+			},
+			Action: func(c *cli.Context) error {
+				mapNames := c.StringSlice("map")
+
+				if len(mapNames) == 0 {
+					mapNames = []string{"hexagon"}
+				}
+
+				args := tournament.TournamentActionArguments{
+					Tps:             c.Int("tps"),
+					Host:            c.String("host"),
+					Agentimages:     c.StringSlice("agent"),
+					MapNames:        mapNames,
+					GroupSize:       c.Int("group-size"),
+					Rounds:          c.Int("rounds"),
+					DurationSeconds: c.Int("duration"),
+					ReportFile:      c.String("report"),
+					IsDebug:         c.Bool("debug"),
+					IsQuiet:         c.Bool("quiet"),
+				}
+
+				showUsage, err := tournament.TournamentAction(args)
+
+				if err != nil {
+					commandFailWith("tournament", showUsage, c, err)
+				}
+
+				return nil
+			},
+		},
 		{
 			Name:    "map",
 			Aliases: []string{},
@@ -147,8 +314,15 @@ func makeapp() *cli.App {
 			},
 			Subcommands: []cli.Command{
 				{
-					Name:  "update",
-					Usage: "Fetch the trainer maps if needed",
+					Name:      "update",
+					Usage:     "Fetch the trainer maps if needed",
+					ArgsUsage: "[name...]",
+					Flags: []cli.Flag{
+						cli.StringSliceFlag{Name: "manifest", EnvVar: "BA_MAP_MANIFEST", Usage: "URL, file:// URL or path of a map manifest; can be repeated, the first manifest listing a map wins (default: " + mapcmd.MANIFEST_URL + ")"},
+						cli.StringSliceFlag{Name: "manifest-pubkey", EnvVar: "BA_MAP_MANIFEST_PUBKEY", Usage: "PEM public key the manifests must be signed with; the signature is fetched from <manifest>" + mapcmd.MANIFEST_SIGNATURE_SUFFIX},
+						cli.IntFlag{Name: "jobs, j", Value: mapcmd.MAP_DOWNLOAD_DEFAULT_JOBS, Usage: "Number of maps downloaded concurrently"},
+						cli.BoolFlag{Name: "check", Usage: "Only report the maps to download; exits with an error if any"},
+					},
 					Action: func(c *cli.Context) error {
 						isDebug := c.Bool("debug")
 
@@ -160,15 +334,346 @@ func makeapp() *cli.App {
 							}
 						}
 
-						mapcmd.MapUpdateAction(debug)
+						err := mapcmd.MapUpdateAction(mapcmd.MapUpdateActionArguments{
+							Debug:           debug,
+							ManifestSources: c.StringSlice("manifest"),
+							PublicKeyFiles:  c.StringSlice("manifest-pubkey"),
+							Jobs:            c.Int("jobs"),
+							Names:           c.Args(),
+							Check:           c.Bool("check"),
+						})
+
+						// Already reported; scripts only need the exit code
+						if _, isOutdated := err.(mapcmd.MapsOutdatedError); isOutdated {
+							os.Exit(1)
+						}
+
+						if err != nil {
+							commandFailWith("update", false, c, err)
+						}
+
 						return nil
 					},
 				},
 				{
 					Name:  "list",
 					Usage: "List the trainer maps locally available",
+					Flags: []cli.Flag{
+						cli.StringFlag{Name: "format", Value: mapcmd.MAP_LIST_FORMAT_TEXT, Usage: "Output format: text, table or json"},
+					},
+					Action: func(c *cli.Context) error {
+						err := mapcmd.MapListAction(c.String("format"))
+
+						if err != nil {
+							commandFailWith("list", false, c, err)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:      "pin",
+					Usage:     "Hold a map at a version, ignoring manifest changes",
+					ArgsUsage: "<name> [checksum]",
+					Action: func(c *cli.Context) error {
+						err := mapcmd.MapPinAction(c.Args().Get(0), c.Args().Get(1))
+
+						if err != nil {
+							commandFailWith("pin", false, c, err)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:      "unpin",
+					Usage:     "Let a pinned map follow the manifest again",
+					ArgsUsage: "<name>",
+					Action: func(c *cli.Context) error {
+						err := mapcmd.MapUnpinAction(c.Args().Get(0))
+
+						if err != nil {
+							commandFailWith("unpin", false, c, err)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:      "export",
+					Usage:     "Bundle the local maps in an archive, for machines without internet access",
+					ArgsUsage: "<out.tar>",
+					Action: func(c *cli.Context) error {
+						err := mapcmd.MapExportAction(c.Args().Get(0))
+
+						if err != nil {
+							commandFailWith("export", false, c, err)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:      "import",
+					Usage:     "Install the maps of an archive made by `map export`",
+					ArgsUsage: "<in.tar>",
+					Flags: []cli.Flag{
+						cli.StringSliceFlag{Name: "manifest", EnvVar: "BA_MAP_MANIFEST", Usage: "URL, file:// URL or path of a map manifest the maps are verified against; can be repeated (default: the local manifest)"},
+						cli.StringSliceFlag{Name: "manifest-pubkey", EnvVar: "BA_MAP_MANIFEST_PUBKEY", Usage: "PEM public key the manifests must be signed with; the signature is fetched from <manifest>" + mapcmd.MANIFEST_SIGNATURE_SUFFIX},
+						cli.BoolFlag{Name: "unverified", Usage: "Also import the maps missing from the manifests, only checked against the manifest of the archive"},
+					},
+					Action: func(c *cli.Context) error {
+						err := mapcmd.MapImportAction(mapcmd.MapImportActionArguments{
+							In:              c.Args().Get(0),
+							ManifestSources: c.StringSlice("manifest"),
+							PublicKeyFiles:  c.StringSlice("manifest-pubkey"),
+							Unverified:      c.Bool("unverified"),
+						})
+
+						if err != nil {
+							commandFailWith("import", false, c, err)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:      "remove",
+					Usage:     "Delete maps from the local cache",
+					ArgsUsage: "<name...>",
+					Flags: []cli.Flag{
+						cli.BoolFlag{Name: "dry-run", Usage: "Only list the files that would be deleted"},
+					},
+					Action: func(c *cli.Context) error {
+						err := mapcmd.MapRemoveAction(mapcmd.MapRemoveActionArguments{
+							Names:  c.Args(),
+							DryRun: c.Bool("dry-run"),
+						})
+
+						if err != nil {
+							commandFailWith("remove", false, c, err)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:  "prune",
+					Usage: "Delete the cached maps no longer in the manifest, or not used recently",
+					Flags: []cli.Flag{
+						cli.IntFlag{Name: "unused-days", Usage: "Also delete the maps not used in this number of days"},
+						cli.BoolFlag{Name: "dry-run", Usage: "Only list the files that would be deleted"},
+					},
+					Action: func(c *cli.Context) error {
+						err := mapcmd.MapPruneAction(mapcmd.MapPruneActionArguments{
+							UnusedDays: c.Int("unused-days"),
+							DryRun:     c.Bool("dry-run"),
+						})
+
+						if err != nil {
+							commandFailWith("prune", false, c, err)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:      "create",
+					Usage:     "Create the directory of a new map pack",
+					ArgsUsage: "<name>",
+					Action: func(c *cli.Context) error {
+						err := mapcmd.MapCreateAction(c.Args().Get(0))
+
+						if err != nil {
+							commandFailWith("create", false, c, err)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:      "pack",
+					Usage:     "Validate and zip a map directory, and print its manifest entry",
+					ArgsUsage: "<directory>",
+					Flags: []cli.Flag{
+						cli.StringFlag{Name: "output, o", Value: "", Usage: "Destination of the map pack (default: <directory>.zip)"},
+						cli.StringFlag{Name: "url", Value: "", Usage: "Base URL the map pack will be served from"},
+						cli.StringFlag{Name: "title", Value: "", Usage: "Title of the map in the manifest"},
+						cli.StringFlag{Name: "comment", Value: "", Usage: "Comment of the map in the manifest"},
+					},
+					Action: func(c *cli.Context) error {
+						args := mapcmd.MapPackActionArguments{
+							Dir:     c.Args().Get(0),
+							Output:  c.String("output"),
+							BaseUrl: c.String("url"),
+							Title:   c.String("title"),
+							Comment: c.String("comment"),
+						}
+
+						err := mapcmd.MapPackAction(args)
+
+						if err != nil {
+							commandFailWith("pack", false, c, err)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:      "show",
+					Usage:     "Print the stats and a preview of a map",
+					ArgsUsage: "<map name or path>",
+					Flags: []cli.Flag{
+						cli.IntFlag{Name: "width", Value: mapcmd.MAP_PREVIEW_DEFAULT_WIDTH, Usage: "Width of the preview, in characters"},
+						cli.StringFlag{Name: "svg", Value: "", Usage: "Also render the map in this SVG file"},
+					},
+					Action: func(c *cli.Context) error {
+						err := mapcmd.MapShowAction(mapcmd.MapShowActionArguments{
+							MapName: c.Args().Get(0),
+							Width:   c.Int("width"),
+							SvgFile: c.String("svg"),
+						})
+
+						if err != nil {
+							commandFailWith("show", false, c, err)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:      "validate",
+					Usage:     "Check a map pack for errors",
+					ArgsUsage: "<map name or path>",
+					Action: func(c *cli.Context) error {
+						err := mapcmd.MapValidateAction(c.Args().Get(0))
+
+						if err != nil {
+							commandFailWith("validate", false, c, err)
+						}
+
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:  "agent",
+			Usage: "Operations on the local agent images",
+			Subcommands: []cli.Command{
+				{
+					Name:  "list",
+					Usage: "List the agent images built or imported locally",
+					Flags: []cli.Flag{
+						cli.StringFlag{Name: "output", Value: agentcmd.AGENT_LIST_OUTPUT_TEXT, Usage: "Output format: text or json"},
+					},
 					Action: func(c *cli.Context) error {
-						mapcmd.MapListAction()
+						err := agentcmd.AgentListAction(c.String("output"))
+
+						if err != nil {
+							commandFailWith("list", false, c, err)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:      "inspect",
+					Usage:     "Show the manifest, size, build hash and creation date of an agent image",
+					ArgsUsage: "<agent id, tag or image id>",
+					BashComplete: func(c *cli.Context) {
+						completion, err := agentcmd.BashComplete()
+
+						if err != nil {
+							commandFailWith("inspect", false, c, err)
+						}
+
+						fmt.Fprintln(c.App.Writer, completion)
+					},
+					Action: func(c *cli.Context) error {
+						err := agentcmd.AgentInspectAction(c.Args().Get(0))
+
+						if err != nil {
+							commandFailWith("inspect", false, c, err)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:      "export",
+					Usage:     "Save an agent image with its manifest and checksum, to hand it over or use it offline",
+					ArgsUsage: "<agent id, tag or image id>",
+					BashComplete: func(c *cli.Context) {
+						completion, err := agentcmd.BashComplete()
+
+						if err != nil {
+							commandFailWith("export", false, c, err)
+						}
+
+						fmt.Fprintln(c.App.Writer, completion)
+					},
+					Flags: []cli.Flag{
+						cli.StringFlag{Name: "output, o", Value: "", Usage: "Destination archive, .tar or .tar.gz (default: <agent id>.tar)"},
+					},
+					Action: func(c *cli.Context) error {
+						err := agentcmd.AgentExportAction(c.Args().Get(0), c.String("output"))
+
+						if err != nil {
+							commandFailWith("export", false, c, err)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:      "import",
+					Usage:     "Load an agent image from an archive made by `agent export`",
+					ArgsUsage: "<in.tar>",
+					Action: func(c *cli.Context) error {
+						err := agentcmd.AgentImportAction(c.Args().Get(0))
+
+						if err != nil {
+							commandFailWith("import", false, c, err)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:      "rm",
+					Usage:     "Remove agent images",
+					ArgsUsage: "[agent id, tag or image id...]",
+					BashComplete: func(c *cli.Context) {
+						completion, err := agentcmd.BashComplete()
+
+						if err != nil {
+							commandFailWith("rm", false, c, err)
+						}
+
+						fmt.Fprintln(c.App.Writer, completion)
+					},
+					Flags: []cli.Flag{
+						cli.BoolFlag{Name: "all, a", Usage: "Remove every image of the named agents, older builds included; a tag is otherwise only untagged"},
+						cli.BoolFlag{Name: "untagged", Usage: "Also remove the images of older builds, replaced by a newer one"},
+						cli.IntFlag{Name: "older-than", Usage: "Also remove the images created more than this number of days ago"},
+						cli.BoolFlag{Name: "force, f", Usage: "Remove images even if used by containers or tagged several times"},
+						cli.BoolFlag{Name: "dry-run", Usage: "Only list the images that would be removed"},
+					},
+					Action: func(c *cli.Context) error {
+						err := agentcmd.AgentRemoveAction(agentcmd.AgentRemoveActionArguments{
+							Names:         c.Args(),
+							All:           c.Bool("all"),
+							Untagged:      c.Bool("untagged"),
+							OlderThanDays: c.Int("older-than"),
+							Force:         c.Bool("force"),
+							DryRun:        c.Bool("dry-run"),
+						})
+
+						if err != nil {
+							commandFailWith("rm", false, c, err)
+						}
+
 						return nil
 					},
 				},
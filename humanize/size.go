@@ -0,0 +1,25 @@
+package humanize
+
+import "fmt"
+
+var (
+	SIZE_UNITS = []string{"B", "KB", "MB", "GB"}
+)
+
+// Size formats a number of bytes with the largest unit under which it is at
+// least 1, e.g. 1.5 MB.
+func Size(size int64) string {
+	value := float64(size)
+	unit := 0
+
+	for value >= 1024 && unit < len(SIZE_UNITS)-1 {
+		value /= 1024
+		unit++
+	}
+
+	if unit == 0 {
+		return fmt.Sprintf("%d %s", size, SIZE_UNITS[unit])
+	}
+
+	return fmt.Sprintf("%.1f %s", value, SIZE_UNITS[unit])
+}
@@ -0,0 +1,22 @@
+package humanize
+
+import "testing"
+
+func TestSize(t *testing.T) {
+	tests := []struct {
+		size     int64
+		expected string
+	}{
+		{size: 0, expected: "0 B"},
+		{size: 1023, expected: "1023 B"},
+		{size: 1024, expected: "1.0 KB"},
+		{size: 1536 * 1024, expected: "1.5 MB"},
+		{size: 3 << 40, expected: "3072.0 GB"},
+	}
+
+	for _, test := range tests {
+		if actual := Size(test.size); actual != test.expected {
+			t.Errorf("%d: expected %s, got %s", test.size, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/builder/dockerignore"
+	"github.com/docker/docker/pkg/fileutils"
+	bettererrors "github.com/xtuc/better-errors"
+)
+
+var (
+	// Both use the .dockerignore syntax; rules of .baignore come last and
+	// take precedence
+	IGNORE_FILES = []string{".dockerignore", ".baignore"}
+
+	// Docker sends the first two even when ignored; .baignore is kept so
+	// that its changes are seen by the watcher and the build context hash
+	NEVER_IGNORED = []string{"Dockerfile", ".dockerignore", ".baignore"}
+)
+
+// Matcher tells which files of an agent directory are left out of its build
+// context.
+type Matcher struct {
+	dir string
+	pm  *fileutils.PatternMatcher
+
+	// Whether the ignore files have exception rules; those of NEVER_IGNORED
+	// only apply to the root of the directory
+	exclusions bool
+}
+
+// Load reads the ignore files of an agent directory; a directory without
+// them ignores nothing.
+func Load(dir string) (*Matcher, error) {
+	absdir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, bettererrors.NewFromErr(err)
+	}
+
+	patterns := make([]string, 0)
+
+	for _, filename := range IGNORE_FILES {
+		location := filepath.Join(absdir, filename)
+
+		file, err := os.Open(location)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return nil, bettererrors.
+				New("Could not open ignore file").
+				With(bettererrors.NewFromErr(err)).
+				SetContext("file", location)
+		}
+
+		filePatterns, err := dockerignore.ReadAll(file)
+		file.Close()
+
+		if err != nil {
+			return nil, bettererrors.
+				New("Could not parse ignore file").
+				With(bettererrors.NewFromErr(err)).
+				SetContext("file", location)
+		}
+
+		patterns = append(patterns, filePatterns...)
+	}
+
+	matcher := &Matcher{dir: absdir}
+
+	if len(patterns) == 0 {
+		return matcher, nil
+	}
+
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "!") {
+			matcher.exclusions = true
+		}
+	}
+
+	for _, name := range NEVER_IGNORED {
+		patterns = append(patterns, "!"+name)
+	}
+
+	matcher.pm, err = fileutils.NewPatternMatcher(patterns)
+	if err != nil {
+		return nil, bettererrors.
+			New("Invalid ignore pattern").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("directory", dir)
+	}
+
+	return matcher, nil
+}
+
+// IsIgnored tells whether a path, absolute or relative to the agent
+// directory, is left out of the build context.
+func (m *Matcher) IsIgnored(path string) bool {
+	if m == nil || m.pm == nil {
+		return false
+	}
+
+	if filepath.IsAbs(path) {
+		rel, err := filepath.Rel(m.dir, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return false
+		}
+
+		path = rel
+	}
+
+	if path == "." {
+		return false
+	}
+
+	ignored, err := m.pm.Matches(filepath.Clean(path))
+
+	return err == nil && ignored
+}
+
+// CanSkipDir tells whether nothing in an ignored directory can be brought
+// back by an exception rule, so that it does not need to be walked.
+func (m *Matcher) CanSkipDir(path string) bool {
+	return m.IsIgnored(path) && !m.exclusions
+}
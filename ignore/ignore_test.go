@@ -0,0 +1,105 @@
+package ignore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func makeAgentDir(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "ba-ignore-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestIsIgnored(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		path     string
+		expected bool
+	}{
+		{name: "no ignore file", files: map[string]string{}, path: "node_modules/a.js", expected: false},
+		{name: "ignored file", files: map[string]string{".dockerignore": "*.log\n"}, path: "debug.log", expected: true},
+		{name: "kept file", files: map[string]string{".dockerignore": "*.log\n"}, path: "index.js", expected: false},
+		{name: "ignored directory", files: map[string]string{".dockerignore": "node_modules\n"}, path: "node_modules/a/b.js", expected: true},
+		{name: "comment", files: map[string]string{".dockerignore": "# node_modules\n"}, path: "node_modules/a.js", expected: false},
+		{name: "baignore", files: map[string]string{".baignore": "tmp\n"}, path: "tmp/cache", expected: true},
+		{name: "baignore exception", files: map[string]string{".dockerignore": "*.md\n", ".baignore": "!README.md\n"}, path: "README.md", expected: false},
+		{name: "Dockerfile", files: map[string]string{".dockerignore": "*\n"}, path: "Dockerfile", expected: false},
+		{name: "dockerignore", files: map[string]string{".dockerignore": "*\n"}, path: ".dockerignore", expected: false},
+		{name: "baignore file", files: map[string]string{".baignore": "*\n"}, path: ".baignore", expected: false},
+		{name: "root", files: map[string]string{".dockerignore": "*\n"}, path: ".", expected: false},
+	}
+
+	for _, test := range tests {
+		dir := makeAgentDir(t, test.files)
+
+		matcher, err := Load(dir)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			os.RemoveAll(dir)
+			continue
+		}
+
+		if actual := matcher.IsIgnored(test.path); actual != test.expected {
+			t.Errorf("%s: %s: expected %v, got %v", test.name, test.path, test.expected, actual)
+		}
+
+		// Watchers give absolute paths
+		if actual := matcher.IsIgnored(filepath.Join(dir, test.path)); actual != test.expected {
+			t.Errorf("%s: absolute %s: expected %v, got %v", test.name, test.path, test.expected, actual)
+		}
+
+		os.RemoveAll(dir)
+	}
+}
+
+func TestIsIgnoredOutside(t *testing.T) {
+	dir := makeAgentDir(t, map[string]string{".dockerignore": "*\n"})
+	defer os.RemoveAll(dir)
+
+	matcher, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if matcher.IsIgnored(filepath.Join(filepath.Dir(dir), "other", "file")) {
+		t.Errorf("expected the files outside of the agent directory not to be ignored")
+	}
+}
+
+func TestCanSkipDir(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected bool
+	}{
+		{name: "ignored", content: "vendor\n", expected: true},
+		{name: "exception", content: "vendor\n!vendor/keep\n", expected: false},
+		{name: "not ignored", content: "*.log\n", expected: false},
+	}
+
+	for _, test := range tests {
+		dir := makeAgentDir(t, map[string]string{".dockerignore": test.content})
+
+		matcher, err := Load(dir)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if actual := matcher.CanSkipDir("vendor"); actual != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, actual)
+		}
+
+		os.RemoveAll(dir)
+	}
+}
@@ -0,0 +1,522 @@
+package agentcmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/jsonmessage"
+	bettererrors "github.com/xtuc/better-errors"
+
+	"github.com/bytearena/ba/humanize"
+	"github.com/bytearena/core/common/types"
+)
+
+const (
+	AGENT_EXPORT_METADATA_ENTRY = "agent.json"
+	AGENT_EXPORT_IMAGE_ENTRY    = "image.tar"
+
+	// Written by `docker save` in image.tar
+	DOCKER_IMAGE_MANIFEST_ENTRY = "manifest.json"
+)
+
+// agentArchiveMetadata describes the image saved in an agent archive.
+// Manifest is the label of the image.
+type agentArchiveMetadata struct {
+	Manifest json.RawMessage `json:"manifest"`
+	ImageId  string          `json:"imageId"`
+	Tags     []string        `json:"tags"`
+	Size     int64           `json:"size"`
+	Sha256   string          `json:"sha256"`
+}
+
+// dockerImageManifest is an entry of the manifest.json of `docker save`;
+// Config is the file of the image config, named after its digest.
+type dockerImageManifest struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+}
+
+// imageId is the id of the image, which is the digest of its config.
+func (manifest dockerImageManifest) imageId() string {
+	return "sha256:" + strings.TrimSuffix(path.Base(manifest.Config), ".json")
+}
+
+func isGzipArchive(filename string) bool {
+	return strings.HasSuffix(filename, ".tar.gz") || strings.HasSuffix(filename, ".tgz")
+}
+
+// AgentExportAction saves the image of an agent in a tar archive along with
+// its manifest and checksum, to be loaded with AgentImportAction.
+func AgentExportAction(name string, out string) error {
+	if name == "" {
+		return bettererrors.New("No agent was specified")
+	}
+
+	cli, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+
+	images, err := GetAgentImages(cli)
+	if err != nil {
+		return err
+	}
+
+	found := findAgentImages(images, name)
+
+	if len(found) == 0 {
+		return bettererrors.
+			New("Agent image not found").
+			SetContext("agent", name)
+	}
+
+	image := found[0]
+
+	// Loaded without tags, it could not be run by its id
+	if !image.IsTagged() {
+		return bettererrors.
+			New("Only tagged agent images can be exported").
+			SetContext("agent", name).
+			SetContext("image", image.ImageId)
+	}
+
+	if out == "" {
+		out = image.Id + ".tar"
+	}
+
+	inspect, _, err := cli.ImageInspectWithRaw(context.Background(), image.ImageId)
+
+	if err != nil || inspect.Config == nil {
+		return bettererrors.
+			New("Could not inspect agent image").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("image", image.ImageId)
+	}
+
+	saved, err := cli.ImageSave(context.Background(), image.Tags)
+
+	if err != nil {
+		return bettererrors.
+			New("Could not save agent image").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("agent", image.Id)
+	}
+
+	// The checksum goes in the metadata, written before the image
+	tmp, err := ioutil.TempFile("", "ba-agent-")
+
+	if err != nil {
+		saved.Close()
+
+		return bettererrors.
+			New("Could not create temporary file").
+			With(bettererrors.NewFromErr(err))
+	}
+
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), saved)
+	saved.Close()
+
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+
+	if err != nil {
+		return bettererrors.
+			New("Could not save agent image").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("agent", image.Id)
+	}
+
+	metadata := agentArchiveMetadata{
+		Manifest: json.RawMessage(inspect.Config.Labels[types.AGENT_MANIFEST_LABEL_KEY]),
+		ImageId:  image.ImageId,
+		Tags:     image.Tags,
+		Size:     size,
+		Sha256:   hex.EncodeToString(h.Sum(nil)),
+	}
+
+	file, err := os.Create(out)
+	if err != nil {
+		return bettererrors.
+			New("Could not create archive").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("location", out)
+	}
+
+	var w io.Writer = file
+	var gw *gzip.Writer
+
+	if isGzipArchive(out) {
+		gw = gzip.NewWriter(file)
+		w = gw
+	}
+
+	tw := tar.NewWriter(w)
+
+	// The metadata goes first so that imports know what to expect
+	data, _ := json.MarshalIndent(metadata, "", "    ")
+	err = writeTarEntry(tw, AGENT_EXPORT_METADATA_ENTRY, int64(len(data)), strings.NewReader(string(data)))
+
+	if err == nil {
+		err = writeTarEntry(tw, AGENT_EXPORT_IMAGE_ENTRY, size, tmp)
+	}
+
+	if err == nil {
+		err = tw.Close()
+	}
+
+	if err == nil && gw != nil {
+		err = gw.Close()
+	}
+
+	file.Close()
+
+	if err != nil {
+		os.Remove(out)
+
+		return bettererrors.
+			New("Could not write archive").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("location", out)
+	}
+
+	fmt.Printf("[OK] Agent %s exported to %s (%s, sha256 %s)\n", image.Id, out, humanize.Size(size), metadata.Sha256)
+
+	return nil
+}
+
+func writeTarEntry(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name: name,
+		Mode: 0644,
+		Size: size,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tw, r)
+
+	return err
+}
+
+// AgentImportAction loads the image of an archive made by AgentExportAction,
+// once its checksum and manifest are verified.
+func AgentImportAction(in string) error {
+	if in == "" {
+		return bettererrors.New("No archive was specified")
+	}
+
+	file, err := os.Open(in)
+	if err != nil {
+		return bettererrors.
+			New("Could not open archive").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("location", in)
+	}
+
+	defer file.Close()
+
+	var r io.Reader = file
+
+	if isGzipArchive(in) {
+		gr, err := gzip.NewReader(file)
+		if err != nil {
+			return bettererrors.
+				New("Could not read archive").
+				With(bettererrors.NewFromErr(err)).
+				SetContext("location", in)
+		}
+
+		defer gr.Close()
+		r = gr
+	}
+
+	var metadata *agentArchiveMetadata
+	var image *os.File
+	var checksum string
+
+	defer func() {
+		if image != nil {
+			image.Close()
+			os.Remove(image.Name())
+		}
+	}()
+
+	tr := tar.NewReader(r)
+
+	for {
+		header, err := tr.Next()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return bettererrors.
+				New("Could not read archive").
+				With(bettererrors.NewFromErr(err)).
+				SetContext("location", in)
+		}
+
+		switch path.Clean(header.Name) {
+		case AGENT_EXPORT_METADATA_ENTRY:
+			data, err := ioutil.ReadAll(tr)
+
+			if err == nil {
+				metadata = &agentArchiveMetadata{}
+				err = json.Unmarshal(data, metadata)
+			}
+
+			if err != nil {
+				return bettererrors.
+					New("Could not parse the metadata of the archive").
+					With(bettererrors.NewFromErr(err)).
+					SetContext("location", in)
+			}
+
+		case AGENT_EXPORT_IMAGE_ENTRY:
+			if image != nil {
+				return bettererrors.
+					New("Archive has several agent images").
+					SetContext("location", in)
+			}
+
+			image, err = ioutil.TempFile("", "ba-agent-")
+
+			if err == nil {
+				checksum, err = extractTarEntry(tr, image)
+			}
+
+			if err != nil {
+				return bettererrors.
+					New("Could not extract agent image").
+					With(bettererrors.NewFromErr(err)).
+					SetContext("location", in)
+			}
+		}
+	}
+
+	if metadata == nil || image == nil {
+		return bettererrors.
+			New("Archive has no agent image or metadata; was it made by `ba agent export`?").
+			SetContext("location", in)
+	}
+
+	if !strings.EqualFold(checksum, metadata.Sha256) {
+		return bettererrors.
+			New("Agent image does not match its checksum").
+			SetContext("expected", metadata.Sha256).
+			SetContext("actual", checksum)
+	}
+
+	// The metadata is only checked against itself by the checksum; the image
+	// must be the one it describes before being loaded
+	imageManifest, err := readDockerImageManifest(image)
+
+	if err != nil {
+		return bettererrors.
+			New("Could not read the agent image of the archive").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("location", in)
+	}
+
+	if imageManifest.imageId() != metadata.ImageId || !isSameTags(imageManifest.RepoTags, metadata.Tags) {
+		return bettererrors.
+			New("Agent image does not match the metadata of the archive").
+			SetContext("expected", metadata.ImageId+" "+strings.Join(metadata.Tags, ",")).
+			SetContext("actual", imageManifest.imageId()+" "+strings.Join(imageManifest.RepoTags, ","))
+	}
+
+	var manifest types.AgentManifest
+
+	if err := json.Unmarshal(metadata.Manifest, &manifest); err != nil {
+		return bettererrors.
+			New("Could not parse the agent manifest of the archive").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("location", in)
+	}
+
+	if err := types.ValidateAgentManifest(manifest); err != nil {
+		return bettererrors.
+			New("Invalid agent manifest").
+			With(err).
+			SetContext("location", in)
+	}
+
+	cli, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+
+	// An image already there is not removed if the import fails
+	_, _, inspectErr := cli.ImageInspectWithRaw(context.Background(), metadata.ImageId)
+	isPresent := inspectErr == nil
+
+	if _, err := image.Seek(0, io.SeekStart); err != nil {
+		return bettererrors.NewFromErr(err)
+	}
+
+	resp, err := cli.ImageLoad(context.Background(), image, true)
+
+	if err != nil {
+		return bettererrors.
+			New("Could not load agent image").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("agent", manifest.Id)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.JSON {
+		err = jsonmessage.DisplayJSONMessagesStream(resp.Body, os.Stdout, 0, false, nil)
+	} else {
+		_, err = io.Copy(os.Stdout, resp.Body)
+	}
+
+	if err != nil {
+		return bettererrors.
+			New("Could not load agent image").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("agent", manifest.Id)
+	}
+
+	// The checksum only covers what the archive says; the image must carry
+	// the same manifest to be run as this agent
+	inspect, _, err := cli.ImageInspectWithRaw(context.Background(), metadata.ImageId)
+
+	if err != nil || inspect.Config == nil || !isSameJSON(inspect.Config.Labels[types.AGENT_MANIFEST_LABEL_KEY], metadata.Manifest) {
+		if isPresent {
+			return bettererrors.
+				New("The image does not carry the agent manifest of the archive; it was already there and was left").
+				SetContext("agent", manifest.Id).
+				SetContext("image", metadata.ImageId)
+		}
+
+		// Untagged, the image goes with its last tag
+		refs := imageManifest.RepoTags
+		if len(refs) == 0 {
+			refs = []string{metadata.ImageId}
+		}
+
+		for _, ref := range refs {
+			cli.ImageRemove(context.Background(), ref, dockertypes.ImageRemoveOptions{PruneChildren: true})
+		}
+
+		return bettererrors.
+			New("The loaded image does not carry the agent manifest of the archive; it was removed").
+			SetContext("agent", manifest.Id).
+			SetContext("image", metadata.ImageId)
+	}
+
+	fmt.Printf("[OK] Agent %s imported; train it with `ba train --agent %s`\n", manifest.Id, manifest.Id)
+
+	return nil
+}
+
+// extractTarEntry copies an entry to file, and returns its sha256.
+func extractTarEntry(r io.Reader, file *os.File) (string, error) {
+	h := sha256.New()
+
+	if _, err := io.Copy(io.MultiWriter(file, h), r); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readDockerImageManifest reads the manifest of an image saved by
+// `docker save`, which must hold a single image.
+func readDockerImageManifest(image *os.File) (dockerImageManifest, error) {
+	var manifest dockerImageManifest
+
+	if _, err := image.Seek(0, io.SeekStart); err != nil {
+		return manifest, err
+	}
+
+	tr := tar.NewReader(image)
+
+	for {
+		header, err := tr.Next()
+
+		if err == io.EOF {
+			return manifest, bettererrors.New("Image has no " + DOCKER_IMAGE_MANIFEST_ENTRY)
+		}
+
+		if err != nil {
+			return manifest, err
+		}
+
+		if path.Clean(header.Name) != DOCKER_IMAGE_MANIFEST_ENTRY {
+			continue
+		}
+
+		var manifests []dockerImageManifest
+
+		if err := json.NewDecoder(tr).Decode(&manifests); err != nil {
+			return manifest, err
+		}
+
+		if len(manifests) != 1 {
+			return manifest, bettererrors.
+				New("Expected a single image").
+				SetContext("images", fmt.Sprintf("%d", len(manifests)))
+		}
+
+		return manifests[0], nil
+	}
+}
+
+// isSameTags compares tags regardless of their order.
+func isSameTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	count := make(map[string]int)
+
+	for _, tag := range a {
+		count[tag]++
+	}
+
+	for _, tag := range b {
+		count[tag]--
+	}
+
+	for _, n := range count {
+		if n != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isSameJSON compares the label of an image with the manifest of an archive,
+// which was reformatted when marshalled.
+func isSameJSON(label string, manifest json.RawMessage) bool {
+	var a, b interface{}
+
+	if json.Unmarshal([]byte(label), &a) != nil || json.Unmarshal(manifest, &b) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,106 @@
+package agentcmd
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func writeImageTar(t *testing.T, entries map[string]string) *os.File {
+	file, err := ioutil.TempFile("", "ba-agent-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tw := tar.NewWriter(file)
+
+	for name, content := range entries {
+		if err := writeTarEntry(tw, name, int64(len(content)), strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+func TestReadDockerImageManifest(t *testing.T) {
+	tests := []struct {
+		name         string
+		entries      map[string]string
+		expectedId   string
+		expectedTags []string
+		isError      bool
+	}{
+		{
+			name: "single image",
+			entries: map[string]string{
+				"abc.json":      "{}",
+				"manifest.json": `[{"Config": "abc.json", "RepoTags": ["my-agent:latest"], "Layers": []}]`,
+			},
+			expectedId:   "sha256:abc",
+			expectedTags: []string{"my-agent:latest"},
+		},
+		{
+			name: "blob config",
+			entries: map[string]string{
+				"manifest.json": `[{"Config": "blobs/sha256/abc", "RepoTags": []}]`,
+			},
+			expectedId:   "sha256:abc",
+			expectedTags: []string{},
+		},
+		{
+			name: "several images",
+			entries: map[string]string{
+				"manifest.json": `[{"Config": "abc.json"}, {"Config": "def.json"}]`,
+			},
+			isError: true,
+		},
+		{
+			name:    "no manifest",
+			entries: map[string]string{"abc.json": "{}"},
+			isError: true,
+		},
+	}
+
+	for _, test := range tests {
+		file := writeImageTar(t, test.entries)
+
+		manifest, err := readDockerImageManifest(file)
+
+		file.Close()
+		os.Remove(file.Name())
+
+		if test.isError {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", test.name, err)
+			continue
+		}
+
+		if manifest.imageId() != test.expectedId || !isSameTags(manifest.RepoTags, test.expectedTags) {
+			t.Errorf("%s: expected %s %v, got %s %v", test.name, test.expectedId, test.expectedTags, manifest.imageId(), manifest.RepoTags)
+		}
+	}
+}
+
+func TestIsSameTags(t *testing.T) {
+	if !isSameTags([]string{"a:1", "a:2"}, []string{"a:2", "a:1"}) {
+		t.Errorf("expected tags in another order to be the same")
+	}
+
+	if isSameTags([]string{"a:1", "a:1"}, []string{"a:1", "a:2"}) {
+		t.Errorf("expected different tags to differ")
+	}
+}
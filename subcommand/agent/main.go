@@ -0,0 +1,500 @@
+package agentcmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	bettererrors "github.com/xtuc/better-errors"
+
+	"github.com/bytearena/ba/humanize"
+	"github.com/bytearena/ba/subcommand/build"
+	"github.com/bytearena/core/common/types"
+)
+
+const (
+	AGENT_LIST_OUTPUT_TEXT = "text"
+	AGENT_LIST_OUTPUT_JSON = "json"
+
+	// Shown in place of the tags of an image replaced by a newer build
+	UNTAGGED = "<none>"
+)
+
+// AgentImage is a local Docker image built by `ba build`, or imported.
+type AgentImage struct {
+	Id        string              `json:"id"`
+	Name      string              `json:"name"`
+	ImageId   string              `json:"imageId"`
+	Tags      []string            `json:"tags"`
+	Created   time.Time           `json:"created"`
+	Size      int64               `json:"size"`
+	BuildHash string              `json:"buildHash,omitempty"`
+	Manifest  types.AgentManifest `json:"manifest"`
+}
+
+// IsTagged tells whether the image is still the one of its agent; older
+// builds lose their tags.
+func (image AgentImage) IsTagged() bool {
+	return len(image.Tags) > 0
+}
+
+func (image AgentImage) shortImageId() string {
+	id := strings.TrimPrefix(image.ImageId, "sha256:")
+
+	if len(id) > 12 {
+		return id[:12]
+	}
+
+	return id
+}
+
+// matches tells whether the image is designated by the agent id, one of its
+// tags or its image id.
+func (image AgentImage) matches(name string) bool {
+	if name == image.Id || name == image.ImageId || name == image.shortImageId() {
+		return true
+	}
+
+	_, isTag := image.tagFor(name)
+
+	return isTag
+}
+
+// tagFor returns the tag of the image designated by name, if name is one.
+func (image AgentImage) tagFor(name string) (string, bool) {
+	for _, tag := range image.Tags {
+		if name == tag || name+":latest" == tag {
+			return tag, true
+		}
+	}
+
+	return "", false
+}
+
+func newDockerClient() (*client.Client, error) {
+	cli, err := client.NewEnvClient()
+
+	if err != nil {
+		return nil, bettererrors.
+			New("Failed to initialize Docker").
+			With(err)
+	}
+
+	return cli, nil
+}
+
+// GetAgentImages lists the local images carrying an agent manifest, the
+// most recent first.
+func GetAgentImages(cli *client.Client) ([]AgentImage, error) {
+	images := make([]AgentImage, 0)
+
+	args := filters.NewArgs()
+	args.Add("label", types.AGENT_MANIFEST_LABEL_KEY)
+
+	summaries, err := cli.ImageList(context.Background(), dockertypes.ImageListOptions{Filters: args})
+
+	if err != nil {
+		return images, bettererrors.
+			New("Could not list Docker images").
+			With(bettererrors.NewFromErr(err))
+	}
+
+	for _, summary := range summaries {
+		var manifest types.AgentManifest
+
+		// Images labelled by hand may not hold a manifest
+		if err := json.Unmarshal([]byte(summary.Labels[types.AGENT_MANIFEST_LABEL_KEY]), &manifest); err != nil {
+			continue
+		}
+
+		tags := make([]string, 0)
+		for _, tag := range summary.RepoTags {
+			if tag != "<none>:<none>" {
+				tags = append(tags, tag)
+			}
+		}
+
+		images = append(images, AgentImage{
+			Id:        manifest.Id,
+			Name:      manifest.Name,
+			ImageId:   summary.ID,
+			Tags:      tags,
+			Created:   time.Unix(summary.Created, 0),
+			Size:      summary.Size,
+			BuildHash: summary.Labels[build.BUILD_CONTEXT_HASH_LABEL_KEY],
+			Manifest:  manifest,
+		})
+	}
+
+	sort.SliceStable(images, func(i, j int) bool {
+		return images[i].Created.After(images[j].Created)
+	})
+
+	return images, nil
+}
+
+// findAgentImages returns the images designated by name, the most recent
+// first.
+func findAgentImages(images []AgentImage, name string) []AgentImage {
+	found := make([]AgentImage, 0)
+
+	for _, image := range images {
+		if image.matches(name) {
+			found = append(found, image)
+		}
+	}
+
+	return found
+}
+
+func AgentListAction(output string) error {
+	if output != AGENT_LIST_OUTPUT_TEXT && output != AGENT_LIST_OUTPUT_JSON {
+		return bettererrors.
+			New("Unknown output format; expected text or json").
+			SetContext("output", output)
+	}
+
+	cli, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+
+	images, err := GetAgentImages(cli)
+	if err != nil {
+		return err
+	}
+
+	if output == AGENT_LIST_OUTPUT_JSON {
+		data, _ := json.MarshalIndent(images, "", "    ")
+		fmt.Println(string(data))
+		return nil
+	}
+
+	if len(images) == 0 {
+		fmt.Println("No agent image found; build one with `ba build`.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "AGENT\tNAME\tTAGS\tIMAGE\tCREATED\tSIZE")
+
+	for _, image := range images {
+		tags := UNTAGGED
+		if image.IsTagged() {
+			tags = strings.Join(image.Tags, ",")
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", image.Id, image.Name, tags, image.shortImageId(), image.Created.Format("2006-01-02 15:04"), humanize.Size(image.Size))
+	}
+
+	w.Flush()
+
+	return nil
+}
+
+func AgentInspectAction(name string) error {
+	if name == "" {
+		return bettererrors.New("No agent was specified")
+	}
+
+	cli, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+
+	images, err := GetAgentImages(cli)
+	if err != nil {
+		return err
+	}
+
+	found := findAgentImages(images, name)
+
+	if len(found) == 0 {
+		return bettererrors.
+			New("Agent image not found").
+			SetContext("agent", name)
+	}
+
+	// Older builds of the agent are listed, not inspected
+	image := found[0]
+
+	manifest, _ := json.MarshalIndent(image.Manifest, "", "    ")
+
+	tags := UNTAGGED
+	if image.IsTagged() {
+		tags = strings.Join(image.Tags, ", ")
+	}
+
+	buildHash := image.BuildHash
+	if buildHash == "" {
+		buildHash = "-"
+	}
+
+	fmt.Println("Agent: " + image.Id)
+	fmt.Println("Name: " + image.Name)
+	fmt.Println("Image: " + image.ImageId)
+	fmt.Println("Tags: " + tags)
+	fmt.Println("Created: " + image.Created.Format(time.RFC1123))
+	fmt.Println("Size: " + humanize.Size(image.Size))
+	fmt.Println("Build context hash: " + buildHash)
+	fmt.Println("Manifest:")
+	fmt.Println(string(manifest))
+
+	if len(found) > 1 {
+		fmt.Println("")
+		fmt.Println("Older images of this agent:")
+
+		for _, older := range found[1:] {
+			fmt.Printf("  %s (%s, %s)\n", older.shortImageId(), older.Created.Format("2006-01-02 15:04"), humanize.Size(older.Size))
+		}
+	}
+
+	return nil
+}
+
+type AgentRemoveActionArguments struct {
+	Names []string
+
+	// All the images of the named agents, older builds included
+	All bool
+
+	// Images of older builds, no longer tagged
+	Untagged bool
+
+	// Images created more than this many days ago
+	OlderThanDays int
+
+	DryRun bool
+	Force  bool
+}
+
+// agentRemoval is an image to remove, or only one of its tags when Tag is
+// set.
+type agentRemoval struct {
+	Image AgentImage
+	Tag   string
+}
+
+// selectRemovals returns what rm removes for the given names: a tag is only
+// untagged, and other names remove the most recent image of the agent unless
+// all is set. The images left are returned apart, to be reported.
+func selectRemovals(images []AgentImage, names []string, all bool) ([]agentRemoval, []AgentImage, error) {
+	removals := make([]agentRemoval, 0)
+	kept := make([]AgentImage, 0)
+
+	for _, name := range names {
+		found := findAgentImages(images, name)
+
+		if len(found) == 0 {
+			return removals, kept, bettererrors.
+				New("Agent image not found").
+				SetContext("agent", name)
+		}
+
+		if all {
+			for _, image := range found {
+				removals = append(removals, agentRemoval{Image: image})
+			}
+
+			continue
+		}
+
+		target := agentRemoval{Image: found[0]}
+
+		for _, image := range found {
+			if tag, isTag := image.tagFor(name); isTag {
+				target = agentRemoval{Image: image, Tag: tag}
+				break
+			}
+		}
+
+		removals = append(removals, target)
+
+		for _, image := range found {
+			if image.ImageId != target.Image.ImageId {
+				kept = append(kept, image)
+			}
+		}
+	}
+
+	return removals, kept, nil
+}
+
+// AgentRemoveAction removes agent images designated by name, or the old
+// ones.
+func AgentRemoveAction(args AgentRemoveActionArguments) error {
+	if len(args.Names) == 0 && !args.Untagged && args.OlderThanDays == 0 {
+		return bettererrors.New("No agent was specified; give names, --untagged or --older-than")
+	}
+
+	if args.OlderThanDays < 0 {
+		return bettererrors.New("The number of days must be positive")
+	}
+
+	cli, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+
+	images, err := GetAgentImages(cli)
+	if err != nil {
+		return err
+	}
+
+	selected, kept, err := selectRemovals(images, args.Names, args.All)
+	if err != nil {
+		return err
+	}
+
+	limit := time.Now().AddDate(0, 0, -args.OlderThanDays)
+
+	for _, image := range images {
+		if (args.Untagged && !image.IsTagged()) || (args.OlderThanDays > 0 && image.Created.Before(limit)) {
+			selected = append(selected, agentRemoval{Image: image})
+		}
+	}
+
+	// Whole images first, so that their tags are not untagged on their own
+	removed := make(map[string]bool)
+	untagged := make(map[string]bool)
+	removals := make([]agentRemoval, 0)
+
+	for _, removal := range selected {
+		if removal.Tag == "" && !removed[removal.Image.ImageId] {
+			removed[removal.Image.ImageId] = true
+			removals = append(removals, removal)
+		}
+	}
+
+	for _, removal := range selected {
+		if removal.Tag != "" && !removed[removal.Image.ImageId] && !untagged[removal.Tag] {
+			untagged[removal.Tag] = true
+			removals = append(removals, removal)
+		}
+	}
+
+	if len(removals) == 0 {
+		fmt.Println("Nothing to remove.")
+		return nil
+	}
+
+	var freed int64
+
+	for _, removal := range removals {
+		image := removal.Image
+		description := fmt.Sprintf("%s %s (%s, created %s)", image.Id, image.shortImageId(), humanize.Size(image.Size), image.Created.Format("2006-01-02"))
+
+		ref := image.ImageId
+		action, done := "remove", "Removed"
+
+		if removal.Tag != "" {
+			ref = removal.Tag
+			action, done = "untag", "Untagged"
+			description = removal.Tag + " from " + description
+		}
+
+		// Docker removes an image along with its last tag
+		isFreed := removal.Tag == "" || len(image.Tags) == 1
+
+		if args.DryRun {
+			fmt.Println("Would " + action + " " + description)
+		} else {
+			deleted, err := cli.ImageRemove(context.Background(), ref, dockertypes.ImageRemoveOptions{
+				Force:         args.Force,
+				PruneChildren: true,
+			})
+
+			if err != nil {
+				return bettererrors.
+					New("Could not remove agent image").
+					With(bettererrors.NewFromErr(err)).
+					SetContext("agent", image.Id).
+					SetContext("image", ref)
+			}
+
+			isFreed = false
+			for _, item := range deleted {
+				if item.Deleted != "" {
+					isFreed = true
+				}
+			}
+
+			fmt.Println(done + " " + description)
+		}
+
+		if isFreed {
+			freed += image.Size
+		}
+	}
+
+	kept = keptImages(kept, removed)
+
+	if len(kept) > 0 {
+		fmt.Println("")
+		fmt.Println("Other images of these agents were kept; remove them with --all:")
+
+		for _, image := range kept {
+			fmt.Printf("  %s %s (%s, created %s)\n", image.Id, image.shortImageId(), humanize.Size(image.Size), image.Created.Format("2006-01-02"))
+		}
+	}
+
+	fmt.Println("")
+
+	if args.DryRun {
+		fmt.Printf("%s would be freed.\n", humanize.Size(freed))
+	} else {
+		fmt.Printf("%s freed.\n", humanize.Size(freed))
+	}
+
+	return nil
+}
+
+// keptImages leaves out of kept the images removed anyway, and duplicates.
+func keptImages(kept []AgentImage, removed map[string]bool) []AgentImage {
+	out := make([]AgentImage, 0)
+	seen := make(map[string]bool)
+
+	for _, image := range kept {
+		if !removed[image.ImageId] && !seen[image.ImageId] {
+			seen[image.ImageId] = true
+			out = append(out, image)
+		}
+	}
+
+	return out
+}
+
+// BashComplete lists the ids of the local agents, for `ba train --agent`.
+func BashComplete() (string, error) {
+	var out string
+
+	cli, err := newDockerClient()
+	if err != nil {
+		return out, err
+	}
+
+	images, err := GetAgentImages(cli)
+	if err != nil {
+		return out, err
+	}
+
+	seen := make(map[string]bool)
+
+	for _, image := range images {
+		if image.IsTagged() && !seen[image.Id] {
+			seen[image.Id] = true
+			out += fmt.Sprintf("%s\n", image.Id)
+		}
+	}
+
+	return out, nil
+}
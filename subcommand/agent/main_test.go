@@ -0,0 +1,74 @@
+package agentcmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSelectRemovals(t *testing.T) {
+	images := []AgentImage{
+		{Id: "my-agent", ImageId: "sha256:ccc", Tags: []string{"my-agent:latest", "my-agent:v2"}},
+		{Id: "my-agent", ImageId: "sha256:bbb", Tags: []string{"my-agent:v1"}},
+		{Id: "my-agent", ImageId: "sha256:aaa", Tags: []string{}},
+	}
+
+	tests := []struct {
+		name             string
+		all              bool
+		expectedRemovals []string
+		expectedKept     []string
+	}{
+		{
+			name:             "my-agent:v2",
+			expectedRemovals: []string{"sha256:ccc my-agent:v2"},
+			expectedKept:     []string{},
+		},
+		{
+			name:             "my-agent",
+			expectedRemovals: []string{"sha256:ccc my-agent:latest"},
+			expectedKept:     []string{"sha256:bbb", "sha256:aaa"},
+		},
+		{
+			name:             "sha256:aaa",
+			expectedRemovals: []string{"sha256:aaa "},
+			expectedKept:     []string{},
+		},
+		{
+			name:             "my-agent",
+			all:              true,
+			expectedRemovals: []string{"sha256:ccc ", "sha256:bbb ", "sha256:aaa "},
+			expectedKept:     []string{},
+		},
+	}
+
+	for _, test := range tests {
+		removals, kept, err := selectRemovals(images, []string{test.name}, test.all)
+
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", test.name, err)
+			continue
+		}
+
+		actualRemovals := make([]string, 0)
+		for _, removal := range removals {
+			actualRemovals = append(actualRemovals, removal.Image.ImageId+" "+removal.Tag)
+		}
+
+		actualKept := make([]string, 0)
+		for _, image := range kept {
+			actualKept = append(actualKept, image.ImageId)
+		}
+
+		if !reflect.DeepEqual(actualRemovals, test.expectedRemovals) {
+			t.Errorf("%s (all %v): expected removals %v, got %v", test.name, test.all, test.expectedRemovals, actualRemovals)
+		}
+
+		if !reflect.DeepEqual(actualKept, test.expectedKept) {
+			t.Errorf("%s (all %v): expected to keep %v, got %v", test.name, test.all, test.expectedKept, actualKept)
+		}
+	}
+
+	if _, _, err := selectRemovals(images, []string{"other"}, false); err == nil {
+		t.Errorf("other: expected an error for an unknown agent")
+	}
+}
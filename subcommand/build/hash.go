@@ -0,0 +1,125 @@
+package build
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/docker/docker/client"
+
+	"github.com/bytearena/ba/ignore"
+)
+
+const (
+	// Label holding the hash of the build context of an image, next to
+	// types.AGENT_MANIFEST_LABEL_KEY
+	BUILD_CONTEXT_HASH_LABEL_KEY = "com.bytearena.build.context-hash"
+)
+
+// hashBuildContext hashes the paths, modes and contents of the files of the
+// build context along with the labels and build options of the image. Unlike
+// the tar of the context, it does not depend on modification times.
+func hashBuildContext(dir string, labels ImageLabels, options BuildOptions) (string, error) {
+	h := sha256.New()
+
+	matcher, err := ignore.Load(dir)
+	if err != nil {
+		return "", err
+	}
+
+	keys := make([]string, 0)
+	for key := range labels {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fmt.Fprintf(h, "label %q %q\n", key, labels[key])
+	}
+
+	// Maps are marshalled with sorted keys
+	encodedOptions, _ := json.Marshal(options)
+	fmt.Fprintf(h, "options %s\n", encodedOptions)
+
+	// Walk is in lexical order, which keeps the hash stable
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		if matcher.IsIgnored(name) {
+			if info.IsDir() && matcher.CanSkipDir(name) {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		name = filepath.ToSlash(name)
+
+		if info.Mode()&os.ModeSymlink == os.ModeSymlink {
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(h, "link %q %q\n", name, link)
+			return nil
+		}
+
+		if !info.Mode().IsRegular() {
+			fmt.Fprintf(h, "entry %q %s\n", name, info.Mode())
+			return nil
+		}
+
+		fmt.Fprintf(h, "file %q %s %d\n", name, info.Mode(), info.Size())
+
+		fh, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		defer fh.Close()
+
+		_, err = io.Copy(h, fh)
+
+		return err
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// isImageUpToDate tells whether the images of all the tags were built from a
+// context of the given hash.
+func isImageUpToDate(cli *client.Client, tags []string, hash string) bool {
+	for _, tag := range tags {
+		inspect, _, err := cli.ImageInspectWithRaw(context.Background(), tag)
+
+		// The image has never been built
+		if err != nil || inspect.Config == nil {
+			return false
+		}
+
+		if inspect.Config.Labels[BUILD_CONTEXT_HASH_LABEL_KEY] != hash {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,80 @@
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHashBuildContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ba-build-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	writeFile := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeFile("Dockerfile", "FROM node:8\nCMD node index.js\n")
+	writeFile("index.js", "console.log('hello')\n")
+	writeFile(".dockerignore", "*.log\n")
+
+	labels := ImageLabels{"com.bytearena.agent": "my-agent"}
+	options := BuildOptions{BuildArgs: map[string]string{"NODE_ENV": "production"}}
+
+	hash := func(labels ImageLabels, options BuildOptions) string {
+		res, err := hashBuildContext(dir, labels, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return res
+	}
+
+	initial := hash(labels, options)
+
+	if actual := hash(labels, options); actual != initial {
+		t.Errorf("unchanged context: expected %s, got %s", initial, actual)
+	}
+
+	// The modification time is not part of the hash
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "index.js"), later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	if actual := hash(labels, options); actual != initial {
+		t.Errorf("touched file: expected %s, got %s", initial, actual)
+	}
+
+	writeFile("debug.log", "ignored\n")
+
+	if actual := hash(labels, options); actual != initial {
+		t.Errorf("ignored file: expected %s, got %s", initial, actual)
+	}
+
+	if actual := hash(ImageLabels{"com.bytearena.agent": "other-agent"}, options); actual == initial {
+		t.Errorf("changed label: expected the hash to change")
+	}
+
+	if actual := hash(labels, BuildOptions{BuildArgs: map[string]string{"NODE_ENV": "development"}}); actual == initial {
+		t.Errorf("changed build option: expected the hash to change")
+	}
+
+	if actual := hash(labels, BuildOptions{BuildArgs: options.BuildArgs, NoCache: true}); actual == initial {
+		t.Errorf("changed build flag: expected the hash to change")
+	}
+
+	writeFile("index.js", "console.log('bye')\n")
+
+	if actual := hash(labels, options); actual == initial {
+		t.Errorf("changed file: expected the hash to change")
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	dockertypes "github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
@@ -19,40 +20,49 @@ import (
 
 	bettererrors "github.com/xtuc/better-errors"
 
+	"github.com/bytearena/ba/humanize"
+	"github.com/bytearena/ba/ignore"
+	"github.com/bytearena/ba/subcommand/lint"
 	"github.com/bytearena/ba/watcher"
-	"github.com/bytearena/core/common/dockerfile"
 	"github.com/bytearena/core/common/types"
-	"github.com/bytearena/core/common/utils"
 )
 
 const (
 	DOCKER_BUILD_FILE = "Dockerfile"
 	SHOW_USAGE        = true
 	DONT_SHOW_USAGE   = false
+
+	BUILD_CONTEXT_WARN_SIZE = 50 * 1024 * 1024
 )
 
 type Arguments struct {
 	WatchMode bool
-}
 
-type ImageLabels map[string]string
+	// Build even if the image was built from the same context
+	Force bool
 
-func welcomeBanner() {
-	fmt.Println("=== ")
-	fmt.Println("=== 🤖  Welcome! I'm the Byte Arena Builder Bot")
-	fmt.Println("=== ")
-	fmt.Println("")
-}
+	// Number of agents built concurrently by MainMany
+	Jobs int
+
+	// Output is text or json; the logs go to stderr with json. Plain logs
+	// have no emojis nor cursor movements
+	Output string
+	Plain  bool
 
-func successBanner(id string) {
-	fmt.Println("")
-	fmt.Println("=== ")
-	fmt.Println("=== ✅  Your agent has been built. Let'em know who's the best!")
-	fmt.Println("===    Its id is: " + id)
-	fmt.Println("=== ")
-	fmt.Println("")
+	// The logs go to stderr, for callers whose stdout holds JSON such as
+	// `ba train --output json`
+	Stderr bool
+
+	// Override the "build" section of ba.json
+	BuildArgs []string
+	Target    string
+	NoCache   bool
+	Pull      bool
+	Tags      []string
 }
 
+type ImageLabels map[string]string
+
 func BashComplete(dir string) (string, error) {
 	var out string
 
@@ -97,111 +107,268 @@ func BashComplete(dir string) (string, error) {
 
 func Main(dir string, args Arguments) (bool, error) {
 
+	log, err := newBuildLog(args)
+
+	if err != nil {
+		return SHOW_USAGE, err
+	}
+
+	// Scripts get a result even when the build could not start
+	fail := func(showUsage bool, err error) (bool, error) {
+		if args.Output == OUTPUT_JSON {
+			printBuildResults([]BuildResult{failedBuildResult(dir, err)})
+		}
+
+		return showUsage, err
+	}
+
 	if dir == "" {
 
 		// determine if current directory contains a Dockerfile
 		pwd, err := os.Getwd()
 		if err != nil {
-			return SHOW_USAGE, bettererrors.New("No target directory was specified and there was an error determining the current working directory")
+			return fail(SHOW_USAGE, bettererrors.New("No target directory was specified and there was an error determining the current working directory"))
 		}
 
 		dir = pwd
 
 		if has, err := hasDockerBuildFile(dir); !has || err != nil {
-			return SHOW_USAGE, bettererrors.New("No target directory was specified, and the current directory does not contain any Dockerfile; is it really the source code of an agent?")
+			return fail(SHOW_USAGE, bettererrors.New("No target directory was specified, and the current directory does not contain any Dockerfile; is it really the source code of an agent?"))
+		}
+	}
+
+	agent, showUsage, err := prepareAgentBuild(dir, args)
+
+	if err != nil {
+		return fail(showUsage, err)
+	}
+
+	cli, err := client.NewEnvClient()
+
+	if err != nil {
+		return fail(DONT_SHOW_USAGE, bettererrors.
+			New("Failed to initialize Docker").
+			With(err))
+	}
+
+	welcomeBanner(log)
+
+	if args.WatchMode {
+
+		watcher, err := watcher.MakeWatcher()
+
+		if err != nil {
+			return fail(DONT_SHOW_USAGE, bettererrors.NewFromErr(err))
 		}
+
+		defer watcher.Close()
+
+		if err := watcher.Add(dir); err != nil {
+			return fail(DONT_SHOW_USAGE, bettererrors.
+				New("Could not watch agent directory").
+				With(err).
+				SetContext("directory", dir))
+		}
+
+		for {
+			result, err := buildAgent(cli, agent, args.Force, log)
+
+			if args.Output == OUTPUT_JSON {
+				printBuildResults([]BuildResult{result})
+			}
+
+			// The agent can be fixed while watching
+			if err != nil && lint.HasErrors(result.Findings) {
+				log.Println("=== The Dockerfile has errors; fix them to build your agent.")
+				log.Println("")
+			} else if err != nil {
+				log.Println("=== The build failed: " + err.Error())
+				log.Println("")
+			}
+
+			log.Printf("Awaiting changes in %s ...\n", dir)
+
+			err = <-watcher.Wait()
+
+			if err != nil {
+				return DONT_SHOW_USAGE, err
+			}
+		}
+
+	} else {
+
+		result, err := buildAgent(cli, agent, args.Force, log)
+
+		if args.Output == OUTPUT_JSON {
+			printBuildResults([]BuildResult{result})
+		}
+
+		if err != nil {
+			return DONT_SHOW_USAGE, err
+		}
+
 	}
 
+	return DONT_SHOW_USAGE, nil
+}
+
+// agentBuild is what is needed to build the image of an agent.
+type agentBuild struct {
+	Dir     string
+	Id      string
+	Tags    []string
+	Labels  ImageLabels
+	Options BuildOptions
+}
+
+func prepareAgentBuild(dir string, args Arguments) (agentBuild, bool, error) {
+	var agent agentBuild
+
 	if is, err := isDirectory(dir); !is {
-		return SHOW_USAGE, err
+		return agent, SHOW_USAGE, err
 	}
 
 	if has, err := hasDockerBuildFile(dir); !has || err != nil {
-		return SHOW_USAGE, bettererrors.New("The specified directory does not contain any Dockerfile; is it really the source code of an agent?")
+		return agent, SHOW_USAGE, bettererrors.
+			New("The specified directory does not contain any Dockerfile; is it really the source code of an agent?").
+			SetContext("directory", dir)
 	}
 
 	// generate a labels map from the agent's ba.json
 	agentManifest, agentManifesterr := types.ParseAgentManifestFromDir(dir)
 
 	if agentManifesterr != nil {
-		return DONT_SHOW_USAGE, bettererrors.
+		return agent, DONT_SHOW_USAGE, bettererrors.
 			New("Failed to parse agent manifest").
-			With(agentManifesterr)
+			With(agentManifesterr).
+			SetContext("directory", dir)
 	}
 
 	agentManifestValiationErr := types.ValidateAgentManifest(agentManifest)
 
 	if agentManifestValiationErr != nil {
-		return DONT_SHOW_USAGE, bettererrors.
+		return agent, DONT_SHOW_USAGE, bettererrors.
 			New("Invalid agent manifest").
-			With(agentManifestValiationErr)
+			With(agentManifestValiationErr).
+			SetContext("directory", dir)
 	}
 
-	cli, err := client.NewEnvClient()
+	buildOptions, buildOptionsErr := getBuildOptions(dir, args)
 
-	if err != nil {
-		return DONT_SHOW_USAGE, bettererrors.
-			New("Failed to initialize Docker").
-			With(err)
+	if buildOptionsErr != nil {
+		return agent, DONT_SHOW_USAGE, buildOptionsErr
 	}
 
-	welcomeBanner()
+	agent = agentBuild{
+		Dir:  dir,
+		Id:   agentManifest.Id,
+		Tags: getImageTags(agentManifest.Id, buildOptions, args),
+		Labels: ImageLabels{
+			types.AGENT_MANIFEST_LABEL_KEY: agentManifest.String(),
+		},
+		Options: buildOptions,
+	}
 
-	id := agentManifest.Id
+	return agent, DONT_SHOW_USAGE, nil
+}
 
-	labels := map[string]string{
-		types.AGENT_MANIFEST_LABEL_KEY: agentManifest.String(),
+// buildAgent builds the image of an agent, unless it was already built from
+// the same context.
+func buildAgent(cli *client.Client, agent agentBuild, force bool, log buildLog) (BuildResult, error) {
+	start := time.Now()
+
+	result := BuildResult{
+		Agent:     agent.Id,
+		Directory: agent.Dir,
+		Tags:      agent.Tags,
+		Labels:    agent.Labels,
+		Warnings:  make([]string, 0),
+		Findings:  make([]lint.Finding, 0),
 	}
 
-	if args.WatchMode {
-
-		watcher, err := watcher.MakeWatcher()
+	done := func(err error) (BuildResult, error) {
+		result.DurationSeconds = time.Since(start).Seconds()
 
 		if err != nil {
-			return DONT_SHOW_USAGE, bettererrors.NewFromErr(err)
+			result.Error = err.Error()
+			return result, err
 		}
 
-		defer watcher.Close()
+		inspect, _, inspectErr := cli.ImageInspectWithRaw(context.Background(), agent.Tags[0])
 
-		watcher.Add(dir)
+		if inspectErr == nil {
+			result.ImageId = inspect.ID
+			result.Size = inspect.Size
+		}
 
-		for {
-			fmt.Println("=== Building your agent now.")
-			fmt.Println("")
+		return result, nil
+	}
 
-			err = runDockerBuild(cli, id, dir, labels)
+	findings, err := lint.LintDir(agent.Dir)
 
-			if err != nil {
-				return DONT_SHOW_USAGE, err
-			}
+	if err != nil {
+		return done(err)
+	}
 
-			successBanner(id)
+	result.Findings = findings
 
-			fmt.Printf("Awaiting changes in %s ...\n", dir)
+	if len(findings) > 0 {
+		log.Println("=== Dockerfile checks:")
+		log.Println("")
+		lint.PrintFindings(log.out, findings)
+		log.Println("")
+	}
 
-			err = <-watcher.Wait()
+	if lint.HasErrors(findings) {
+		return done(bettererrors.
+			New("The Dockerfile has errors").
+			SetContext("directory", agent.Dir))
+	}
 
-			if err != nil {
-				return DONT_SHOW_USAGE, err
-			}
-		}
+	hash, err := hashBuildContext(agent.Dir, agent.Labels, agent.Options)
 
-	} else {
+	if err != nil {
+		return done(bettererrors.
+			New("Could not hash the build context").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("directory", agent.Dir))
+	}
 
-		fmt.Println("=== Building your agent now.")
-		fmt.Println("")
+	// Base images may have changed without the context changing
+	if agent.Options.NoCache || agent.Options.Pull {
+		force = true
+	}
 
-		err = runDockerBuild(cli, id, dir, labels)
+	imageLabels := ImageLabels{
+		BUILD_CONTEXT_HASH_LABEL_KEY: hash,
+	}
 
-		if err != nil {
-			return DONT_SHOW_USAGE, err
-		}
+	for key, value := range agent.Labels {
+		imageLabels[key] = value
+	}
 
-		successBanner(id)
+	result.Labels = imageLabels
 
+	if !force && isImageUpToDate(cli, agent.Tags, hash) {
+		log.Println("=== Nothing changed since the last build of " + agent.Tags[0] + "; skipping it.")
+		log.Println("")
+		return done(nil)
 	}
 
-	return DONT_SHOW_USAGE, nil
+	log.Println("=== Building your agent now.")
+	log.Println("")
+
+	warnings, err := runDockerBuild(cli, agent.Tags, agent.Dir, imageLabels, agent.Options, log)
+	result.Warnings = append(result.Warnings, warnings...)
+
+	if err != nil {
+		return done(err)
+	}
+
+	result.Built = true
+	successBanner(log, agent.Tags[0])
+
+	return done(nil)
 }
 
 func isDirectory(directory string) (bool, error) {
@@ -233,24 +400,23 @@ func hasDockerBuildFile(inDirectory string) (bool, error) {
 
 // Build a dir
 // The dockerfile must be in the dir
-func createTar(dir string) (io.Reader, error) {
+func createTar(dir string) (*bytes.Buffer, error) {
 	buff := bytes.NewBuffer(nil)
 	tw := tar.NewWriter(buff)
 
-	// Assert dockerfile
-	dockerfileContents, err := ioutil.ReadFile(path.Join(dir, DOCKER_BUILD_FILE))
+	matcher, err := ignore.Load(dir)
 
 	if err != nil {
 		return buff, err
 	}
 
-	err = failForbiddenInstructions(dockerfileContents)
+	err = doTar(tw, dir, dir, matcher)
 
 	if err != nil {
 		return buff, err
 	}
 
-	err = doTar(tw, dir, dir)
+	err = tw.Close()
 
 	if err != nil {
 		return buff, err
@@ -259,7 +425,7 @@ func createTar(dir string) (io.Reader, error) {
 	return buff, nil
 }
 
-func doTar(tw *tar.Writer, dir string, basedir string) error {
+func doTar(tw *tar.Writer, dir string, basedir string, matcher *ignore.Matcher) error {
 	basedir = strings.TrimSuffix(basedir, "/") + "/"
 
 	// from https://stackoverflow.com/a/40003617
@@ -270,6 +436,14 @@ func doTar(tw *tar.Writer, dir string, basedir string) error {
 			return err
 		}
 
+		if rel, err := filepath.Rel(dir, path); err == nil && matcher.IsIgnored(rel) {
+			if info.IsDir() && matcher.CanSkipDir(rel) {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
 		var link string
 		if info.Mode()&os.ModeSymlink == os.ModeSymlink {
 			if link, err = os.Readlink(path); err != nil {
@@ -310,57 +484,69 @@ func doTar(tw *tar.Writer, dir string, basedir string) error {
 	return nil
 }
 
-func runDockerBuild(cli *client.Client, name, dir string, labels ImageLabels) error {
+func runDockerBuild(cli *client.Client, tags []string, dir string, labels ImageLabels, options BuildOptions, log buildLog) ([]string, error) {
 	ctx := context.Background()
+	warnings := make([]string, 0)
 
-	// TODO(sven): in addition of the name, we can add a tag to be able to list
-	// our images. Useful in the bash autocomplete instead of listing the entire
-	// local registry.
+	// Agent images are listed by their types.AGENT_MANIFEST_LABEL_KEY label,
+	// see `ba agent list`
 	opts := dockertypes.ImageBuildOptions{
-		Tags:   []string{name},
-		Labels: labels,
+		Tags:       tags,
+		Labels:     labels,
+		BuildArgs:  options.getDockerBuildArgs(),
+		Target:     options.Target,
+		NoCache:    options.NoCache,
+		PullParent: options.Pull,
 	}
 
 	tar, tarErr := createTar(dir)
 	if tarErr != nil {
-		return tarErr
+		return warnings, tarErr
+	}
+
+	log.Println("=== Build context: " + humanize.Size(int64(tar.Len())))
+	log.Println("")
+
+	if tar.Len() > BUILD_CONTEXT_WARN_SIZE {
+		warning := "The build context is large (" + humanize.Size(int64(tar.Len())) + "); leave out what the agent does not need with a .dockerignore or .baignore file."
+		warnings = append(warnings, warning)
+
+		if log.plain {
+			log.Println("=== Warning: " + warning)
+		} else {
+			log.Println("=== ⚠️  " + warning)
+		}
+
+		log.Println("")
 	}
 
 	resp, err := cli.ImageBuild(ctx, tar, opts)
 
 	if err != nil {
-		return bettererrors.
+		return warnings, bettererrors.
 			New("Docker build failed").
 			With(err)
 	}
 
 	reader := resp.Body
+	defer reader.Close()
 
-	fd, isTerminal := term.GetFdInfo(os.Stdout)
+	fd, isTerminal := term.GetFdInfo(log.out)
 
-	if err := jsonmessage.DisplayJSONMessagesStream(reader, os.Stdout, fd, isTerminal, nil); err != nil {
-		return err
+	// Without a terminal, progress is printed line by line
+	if log.plain {
+		isTerminal = false
 	}
 
-	reader.Close()
+	collector := &warningCollector{}
+	stream := io.TeeReader(reader, collector)
 
-	return nil
-}
-
-func failForbiddenInstructions(content []byte) error {
-	forbiddenInstructions, err := dockerfile.DockerfileFindForbiddenInstructions(bytes.NewReader(content))
+	err = jsonmessage.DisplayJSONMessagesStream(stream, log.out, fd, isTerminal, nil)
+	warnings = append(warnings, collector.warnings...)
 
 	if err != nil {
-		return err
+		return warnings, err
 	}
 
-	for name, _ := range forbiddenInstructions {
-		berror := bettererrors.
-			New("Forbidden instruction. Remember to remove it when you will to deploy your agent.").
-			SetContext("name", name.String())
-
-		utils.FailWith(berror)
-	}
-
-	return nil
+	return warnings, nil
 }
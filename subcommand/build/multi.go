@@ -0,0 +1,321 @@
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/docker/docker/client"
+	bettererrors "github.com/xtuc/better-errors"
+)
+
+const (
+	BUILD_DEFAULT_JOBS = 4
+)
+
+// MainMany builds the agents of several directories or globs, at most
+// args.Jobs at a time.
+func MainMany(patterns []string, args Arguments) (bool, error) {
+	if len(patterns) <= 1 && !hasGlob(patterns) {
+		dir := ""
+		if len(patterns) == 1 {
+			dir = patterns[0]
+		}
+
+		return Main(dir, args)
+	}
+
+	var dirs []string
+	var results []BuildResult
+
+	// Scripts get a result even when the builds could not start: one for
+	// the patterns until the directories are known, then one per directory
+	fail := func(showUsage bool, err error) (bool, error) {
+		if args.Output != OUTPUT_JSON {
+			return showUsage, err
+		}
+
+		if results == nil {
+			printBuildResults([]BuildResult{failedBuildResult(strings.Join(patterns, " "), err)})
+			return showUsage, err
+		}
+
+		for i, dir := range dirs {
+			if results[i].Error == "" {
+				results[i] = failedBuildResult(dir, err)
+			}
+		}
+
+		printBuildResults(results)
+
+		return showUsage, err
+	}
+
+	if args.WatchMode {
+		return fail(SHOW_USAGE, bettererrors.New("Watch mode only supports a single agent"))
+	}
+
+	log, err := newBuildLog(args)
+	if err != nil {
+		return fail(SHOW_USAGE, err)
+	}
+
+	dirs, err = expandAgentDirs(patterns)
+	if err != nil {
+		return fail(SHOW_USAGE, err)
+	}
+
+	if len(dirs) == 0 {
+		return fail(SHOW_USAGE, bettererrors.
+			New("No agent directory matches").
+			SetContext("patterns", strings.Join(patterns, " ")))
+	}
+
+	// Agents which can't be prepared are reported with the results; the
+	// others are still built
+	agents := make([]agentBuild, 0)
+	results = make([]BuildResult, len(dirs))
+	indexes := make([]int, 0)
+	dirsByTag := make(map[string]string)
+
+	for i, dir := range dirs {
+		agent, _, err := prepareAgentBuild(dir, args)
+
+		if err != nil {
+			results[i] = failedBuildResult(dir, err)
+
+			continue
+		}
+
+		// The last build would take the tag of the others, with the same
+		// agent id or --tag
+		for _, tag := range agent.Tags {
+			if other, ok := dirsByTag[tag]; ok {
+				return fail(DONT_SHOW_USAGE, bettererrors.
+					New("Several agents would be built with the same tag").
+					SetContext("tag", tag).
+					SetContext("directories", other+" "+dir))
+			}
+
+			dirsByTag[tag] = dir
+		}
+		agents = append(agents, agent)
+		indexes = append(indexes, i)
+	}
+
+	cli, err := client.NewEnvClient()
+
+	if err != nil {
+		return fail(DONT_SHOW_USAGE, bettererrors.
+			New("Failed to initialize Docker").
+			With(err))
+	}
+
+	welcomeBanner(log)
+
+	jobs := args.Jobs
+	if jobs <= 0 {
+		jobs = BUILD_DEFAULT_JOBS
+	}
+
+	log.Printf("=== Building %d agents, %d at a time.\n", len(agents), jobs)
+	log.Println("")
+
+	queue := make(chan int)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range queue {
+				agent := agents[i]
+				out := &prefixWriter{prefix: "[" + agent.Id + "] ", out: log.out, mu: &mu}
+
+				// Interleaved progress can't redraw lines
+				results[indexes[i]], _ = buildAgent(cli, agent, args.Force, buildLog{out: out, plain: true})
+				out.Flush()
+			}
+		}()
+	}
+
+	for i := range agents {
+		queue <- i
+	}
+
+	close(queue)
+	wg.Wait()
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+
+	if args.Output == OUTPUT_JSON {
+		printBuildResults(results)
+	} else {
+		printBuildSummary(log, results)
+	}
+
+	if failed > 0 {
+		return DONT_SHOW_USAGE, bettererrors.
+			New("Some agents could not be built").
+			SetContext("failed", fmt.Sprintf("%d", failed))
+	}
+
+	return DONT_SHOW_USAGE, nil
+}
+
+func hasGlob(patterns []string) bool {
+	for _, pattern := range patterns {
+		if strings.ContainsAny(pattern, "*?[") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// expandAgentDirs resolves the globs; the directories they match without a
+// Dockerfile are left out, while explicit ones are kept to be reported.
+func expandAgentDirs(patterns []string) ([]string, error) {
+	dirs := make([]string, 0)
+	seen := make(map[string]bool)
+
+	add := func(dir string) {
+		dir = filepath.Clean(dir)
+
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+
+	for _, pattern := range patterns {
+		if !hasGlob([]string{pattern}) {
+			add(pattern)
+			continue
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, bettererrors.
+				New("Invalid pattern").
+				With(bettererrors.NewFromErr(err)).
+				SetContext("pattern", pattern)
+		}
+
+		for _, match := range matches {
+			if has, _ := hasDockerBuildFile(match); has {
+				add(match)
+			}
+		}
+	}
+
+	return dirs, nil
+}
+
+func printBuildSummary(log buildLog, results []BuildResult) {
+	log.Println("")
+	log.Println("=== Summary")
+	log.Println("")
+
+	w := tabwriter.NewWriter(log.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "AGENT\tDIRECTORY\tIMAGE\tDURATION\tSTATUS")
+
+	for _, result := range results {
+		status := "built"
+
+		switch {
+		case result.Error != "":
+			status = "failed: " + strings.Replace(result.Error, "\n", " ", -1)
+		case !result.Built:
+			status = "unchanged"
+		}
+
+		imageId := strings.TrimPrefix(result.ImageId, "sha256:")
+		if len(imageId) > 12 {
+			imageId = imageId[:12]
+		}
+
+		if imageId == "" {
+			imageId = "-"
+		}
+
+		agent := result.Agent
+		if agent == "" {
+			agent = "-"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.1fs\t%s\n", agent, result.Directory, imageId, result.DurationSeconds, status)
+	}
+
+	w.Flush()
+}
+
+// prefixWriter prefixes each line written to out, keeping the lines of
+// concurrent builds whole.
+type prefixWriter struct {
+	prefix string
+	out    io.Writer
+	mu     *sync.Mutex
+	buf    bytes.Buffer
+
+	// Whether the last line ended with a carriage return
+	cr bool
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+
+	for {
+		data := w.buf.Bytes()
+
+		i := bytes.IndexAny(data, "\n\r")
+		if i < 0 {
+			break
+		}
+
+		line := string(data[:i])
+		terminator := data[i]
+		w.buf.Next(i + 1)
+
+		// Progress bars redraw lines with carriage returns, and CRLF ends a
+		// single line
+		skip := line == "" && (terminator == '\r' || w.cr)
+		w.cr = terminator == '\r'
+
+		if skip {
+			continue
+		}
+
+		w.mu.Lock()
+		fmt.Fprintln(w.out, w.prefix+line)
+		w.mu.Unlock()
+	}
+
+	return len(p), nil
+}
+
+// Flush writes what is left of an unterminated line.
+func (w *prefixWriter) Flush() {
+	if w.buf.Len() == 0 {
+		return
+	}
+
+	w.mu.Lock()
+	fmt.Fprintln(w.out, w.prefix+w.buf.String())
+	w.mu.Unlock()
+
+	w.buf.Reset()
+}
@@ -0,0 +1,157 @@
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		writes   []string
+		expected string
+	}{
+		{
+			name:     "lines",
+			writes:   []string{"Step 1/2\nStep 2/2\n"},
+			expected: "[a] Step 1/2\n[a] Step 2/2\n",
+		},
+		{
+			name:     "split line",
+			writes:   []string{"Step ", "1/2\nSte", "p 2/2\n"},
+			expected: "[a] Step 1/2\n[a] Step 2/2\n",
+		},
+		{
+			name:     "unterminated line",
+			writes:   []string{"Step 1/2\nSuccess"},
+			expected: "[a] Step 1/2\n[a] Success\n",
+		},
+		{
+			name:     "carriage returns",
+			writes:   []string{"10%\r50%\r\n"},
+			expected: "[a] 10%\n[a] 50%\n",
+		},
+		{
+			name:     "empty lines",
+			writes:   []string{"\n\n"},
+			expected: "[a] \n[a] \n",
+		},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		w := &prefixWriter{prefix: "[a] ", out: &out, mu: &sync.Mutex{}}
+
+		for _, data := range test.writes {
+			if n, err := w.Write([]byte(data)); err != nil || n != len(data) {
+				t.Errorf("%s: wrote %d bytes of %d (%v)", test.name, n, len(data), err)
+			}
+		}
+
+		w.Flush()
+
+		if out.String() != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, out.String())
+		}
+	}
+}
+
+func TestPrefixWriterConcurrent(t *testing.T) {
+	var out bytes.Buffer
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, prefix := range []string{"[a] ", "[b] "} {
+		w := &prefixWriter{prefix: prefix, out: &out, mu: &mu}
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < 100; i++ {
+				w.Write([]byte("a whole line\n"))
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	for _, line := range bytes.Split(bytes.TrimSuffix(out.Bytes(), []byte("\n")), []byte("\n")) {
+		if s := string(line); s != "[a] a whole line" && s != "[b] a whole line" {
+			t.Errorf("interleaved line %q", s)
+		}
+	}
+}
+
+// captureStdout returns what f prints on stdout.
+func captureStdout(t *testing.T, f func()) []byte {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+
+	f()
+
+	os.Stdout = stdout
+	w.Close()
+
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return out
+}
+
+func TestMainManyEarlyErrorsAsJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ba-build-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	nomatch := filepath.Join(dir, "*")
+
+	tests := []struct {
+		name     string
+		patterns []string
+		args     Arguments
+	}{
+		{name: "watch mode", patterns: []string{"a", "b"}, args: Arguments{WatchMode: true, Output: OUTPUT_JSON}},
+		{name: "invalid pattern", patterns: []string{"[", "b"}, args: Arguments{Output: OUTPUT_JSON}},
+		{name: "no matching directory", patterns: []string{nomatch}, args: Arguments{Output: OUTPUT_JSON}},
+	}
+
+	for _, test := range tests {
+		var err error
+
+		out := captureStdout(t, func() {
+			_, err = MainMany(test.patterns, test.args)
+		})
+
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+			continue
+		}
+
+		var results []BuildResult
+
+		if err := json.Unmarshal(out, &results); err != nil {
+			t.Errorf("%s: expected a JSON array, got %q", test.name, out)
+			continue
+		}
+
+		if len(results) != 1 || results[0].Error != err.Error() {
+			t.Errorf("%s: expected one failed result for %q, got %+v", test.name, err.Error(), results)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package build
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	bettererrors "github.com/xtuc/better-errors"
+)
+
+const (
+	AGENT_MANIFEST_FILE = "ba.json"
+)
+
+// BuildOptions are passed to the Docker build of an agent. They can be set
+// in the "build" section of ba.json, and overridden from the command line.
+// There is no platform option: the Docker client ba is built with predates
+// it.
+type BuildOptions struct {
+	BuildArgs map[string]string `json:"args"`
+	Target    string            `json:"target"`
+	NoCache   bool              `json:"nocache"`
+	Pull      bool              `json:"pull"`
+	Tags      []string          `json:"tags"`
+}
+
+// readBuildOptions reads the "build" section of the ba.json of an agent;
+// the rest of the file is parsed by types.ParseAgentManifestFromDir.
+func readBuildOptions(dir string) (BuildOptions, error) {
+	var manifest struct {
+		Build BuildOptions `json:"build"`
+	}
+
+	location := path.Join(dir, AGENT_MANIFEST_FILE)
+
+	data, err := ioutil.ReadFile(location)
+	if err != nil {
+		return manifest.Build, bettererrors.
+			New("Could not read agent manifest").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("file", location)
+	}
+
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest.Build, bettererrors.
+			New("Invalid build section in agent manifest").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("file", location)
+	}
+
+	return manifest.Build, nil
+}
+
+// getBuildOptions merges the options of ba.json with the ones given on the
+// command line, which take precedence.
+func getBuildOptions(dir string, args Arguments) (BuildOptions, error) {
+	options, err := readBuildOptions(dir)
+	if err != nil {
+		return options, err
+	}
+
+	buildArgs := make(map[string]string)
+
+	for key, value := range options.BuildArgs {
+		buildArgs[key] = value
+	}
+
+	for _, arg := range args.BuildArgs {
+		parts := strings.SplitN(arg, "=", 2)
+
+		if parts[0] == "" {
+			return options, bettererrors.
+				New("Invalid build argument; expected KEY=VALUE or KEY").
+				SetContext("argument", arg)
+		}
+
+		// Like Docker, a name alone takes its value from the environment
+		if len(parts) == 1 {
+			value, ok := os.LookupEnv(parts[0])
+			if !ok {
+				continue
+			}
+
+			parts = append(parts, value)
+		}
+
+		buildArgs[parts[0]] = parts[1]
+	}
+
+	options.BuildArgs = buildArgs
+
+	if args.Target != "" {
+		options.Target = args.Target
+	}
+
+	options.NoCache = options.NoCache || args.NoCache
+	options.Pull = options.Pull || args.Pull
+	options.Tags = append(options.Tags, args.Tags...)
+
+	return options, nil
+}
+
+func (options BuildOptions) getDockerBuildArgs() map[string]*string {
+	buildArgs := make(map[string]*string)
+
+	for key := range options.BuildArgs {
+		value := options.BuildArgs[key]
+		buildArgs[key] = &value
+	}
+
+	return buildArgs
+}
+
+// getImageTags returns the tags of the image of an agent. Variants asked for
+// on the command line with --tag or --target are only tagged as such, not to
+// replace the image of the agent run by `ba train`.
+func getImageTags(id string, options BuildOptions, args Arguments) []string {
+	if len(args.Tags) > 0 {
+		return args.Tags
+	}
+
+	if args.Target != "" {
+		return []string{id + ":" + args.Target}
+	}
+
+	return append([]string{id}, options.Tags...)
+}
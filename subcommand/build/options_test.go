@@ -0,0 +1,47 @@
+package build
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetImageTags(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  BuildOptions
+		args     Arguments
+		expected []string
+	}{
+		{
+			name:     "default",
+			expected: []string{"my-agent"},
+		},
+		{
+			name:     "ba.json tags",
+			options:  BuildOptions{Tags: []string{"my-agent:v2"}},
+			expected: []string{"my-agent", "my-agent:v2"},
+		},
+		{
+			name:     "variant tag",
+			options:  BuildOptions{Tags: []string{"my-agent:v2"}},
+			args:     Arguments{Tags: []string{"my-agent:debug"}},
+			expected: []string{"my-agent:debug"},
+		},
+		{
+			name:     "variant target",
+			args:     Arguments{Target: "debug"},
+			expected: []string{"my-agent:debug"},
+		},
+		{
+			name:     "variant target and tag",
+			args:     Arguments{Target: "debug", Tags: []string{"my-agent:slow"}},
+			expected: []string{"my-agent:slow"},
+		},
+	}
+
+	for _, test := range tests {
+		if actual := getImageTags("my-agent", test.options, test.args); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, actual)
+		}
+	}
+}
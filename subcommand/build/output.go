@@ -0,0 +1,168 @@
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/docker/docker/pkg/jsonmessage"
+	bettererrors "github.com/xtuc/better-errors"
+
+	"github.com/bytearena/ba/subcommand/lint"
+)
+
+const (
+	OUTPUT_TEXT = "text"
+	OUTPUT_JSON = "json"
+)
+
+var (
+	DOCKER_WARNING_PREFIXES = []string{"[Warning]", "WARNING:", "[WARNING]"}
+)
+
+// BuildResult is printed for each agent with `--output json`.
+type BuildResult struct {
+	Agent           string            `json:"agent"`
+	Directory       string            `json:"directory"`
+	ImageId         string            `json:"imageId"`
+	Tags            []string          `json:"tags"`
+	Labels          map[string]string `json:"labels"`
+	Size            int64             `json:"size"`
+	DurationSeconds float64           `json:"durationSeconds"`
+	Built           bool              `json:"built"`
+	Warnings        []string          `json:"warnings"`
+	Findings        []lint.Finding    `json:"findings"`
+	Error           string            `json:"error,omitempty"`
+}
+
+// buildLog is where the progress of builds goes: stdout, or stderr when
+// stdout holds the JSON results. Plain logs have no emojis nor cursor
+// movements, for CI.
+type buildLog struct {
+	out   io.Writer
+	plain bool
+}
+
+func newBuildLog(args Arguments) (buildLog, error) {
+	switch args.Output {
+	case OUTPUT_JSON:
+		return buildLog{out: os.Stderr, plain: true}, nil
+	case OUTPUT_TEXT, "":
+		if args.Stderr {
+			return buildLog{out: os.Stderr, plain: args.Plain}, nil
+		}
+
+		return buildLog{out: os.Stdout, plain: args.Plain}, nil
+	}
+
+	return buildLog{}, bettererrors.
+		New("Unknown output format; expected text or json").
+		SetContext("output", args.Output)
+}
+
+func (log buildLog) Println(a ...interface{}) {
+	fmt.Fprintln(log.out, a...)
+}
+
+func (log buildLog) Printf(format string, a ...interface{}) {
+	fmt.Fprintf(log.out, format, a...)
+}
+
+func welcomeBanner(log buildLog) {
+	if log.plain {
+		log.Println("=== Byte Arena Builder Bot")
+		log.Println("")
+		return
+	}
+
+	log.Println("=== ")
+	log.Println("=== 🤖  Welcome! I'm the Byte Arena Builder Bot")
+	log.Println("=== ")
+	log.Println("")
+}
+
+func successBanner(log buildLog, id string) {
+	if log.plain {
+		log.Println("")
+		log.Println("=== Agent " + id + " has been built.")
+		log.Println("")
+		return
+	}
+
+	log.Println("")
+	log.Println("=== ")
+	log.Println("=== ✅  Your agent has been built. Let'em know who's the best!")
+	log.Println("===    Its id is: " + id)
+	log.Println("=== ")
+	log.Println("")
+}
+
+// printBuildResults prints an array of results, whether one or several
+// agents were built.
+func printBuildResults(results []BuildResult) {
+	data, _ := json.MarshalIndent(results, "", "    ")
+	fmt.Println(string(data))
+}
+
+// failedBuildResult is the result of an agent whose build could not start;
+// dir may be the patterns given to MainMany.
+func failedBuildResult(dir string, err error) BuildResult {
+	return BuildResult{
+		Directory: dir,
+		Tags:      make([]string, 0),
+		Labels:    make(map[string]string),
+		Warnings:  make([]string, 0),
+		Findings:  make([]lint.Finding, 0),
+		Error:     err.Error(),
+	}
+}
+
+// warningCollector reads the JSON stream of a Docker build, to gather the
+// warnings of Docker itself; the output of the build steps is left out.
+type warningCollector struct {
+	buf      bytes.Buffer
+	warnings []string
+}
+
+func (c *warningCollector) Write(p []byte) (int, error) {
+	c.buf.Write(p)
+
+	for {
+		data := c.buf.Bytes()
+
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+
+		var msg jsonmessage.JSONMessage
+
+		if err := json.Unmarshal(data[:i], &msg); err == nil {
+			text := strings.TrimSpace(msg.Stream)
+
+			if isDockerWarning(text) {
+				c.warnings = append(c.warnings, text)
+			}
+		}
+
+		c.buf.Next(i + 1)
+	}
+
+	return len(p), nil
+}
+
+// isDockerWarning tells whether a line of a build stream is a warning of the
+// Docker daemon or client, such as unused build arguments, rather than a
+// line printed by a build step.
+func isDockerWarning(line string) bool {
+	for _, prefix := range DOCKER_WARNING_PREFIXES {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math/rand"
 	"os"
 	"os/exec"
 	"path"
+	"time"
 
 	"github.com/Masterminds/semver"
 	"github.com/docker/docker/client"
@@ -91,6 +93,9 @@ func Main(name string) (bool, error) {
 		name = "unknown"
 	}
 
+	// Games seed the global source themselves, from their --seed
+	rand.Seed(time.Now().UnixNano())
+
 	petname := petname.Generate(2, "-")
 	dest := petname
 
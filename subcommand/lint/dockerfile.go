@@ -0,0 +1,262 @@
+package lint
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/builder/dockerfile/command"
+	"github.com/docker/docker/builder/dockerfile/parser"
+	bettererrors "github.com/xtuc/better-errors"
+
+	"github.com/bytearena/core/common/dockerfile"
+)
+
+const (
+	SEVERITY_ERROR   = "error"
+	SEVERITY_WARNING = "warning"
+	SEVERITY_INFO    = "info"
+)
+
+var (
+	// ADD extracts them, which COPY can't do
+	ARCHIVE_EXTENSIONS = []string{".tar", ".tar.gz", ".tgz", ".tar.bz2", ".tbz2", ".tar.xz", ".txz"}
+)
+
+// Finding is a problem found in a Dockerfile. Line is 0 when the problem is
+// not tied to an instruction.
+type Finding struct {
+	Line        int    `json:"line"`
+	Severity    string `json:"severity"`
+	Instruction string `json:"instruction,omitempty"`
+	Message     string `json:"message"`
+	Suggestion  string `json:"suggestion,omitempty"`
+}
+
+func (f Finding) String() string {
+	location := DOCKER_BUILD_FILE
+	if f.Line > 0 {
+		location = fmt.Sprintf("%s:%d", DOCKER_BUILD_FILE, f.Line)
+	}
+
+	if f.Suggestion == "" {
+		return fmt.Sprintf("%s: %s: %s", location, f.Severity, f.Message)
+	}
+
+	return fmt.Sprintf("%s: %s: %s (%s)", location, f.Severity, f.Message, f.Suggestion)
+}
+
+// HasErrors tells whether some findings prevent the agent from being built.
+func HasErrors(findings []Finding) bool {
+	for _, finding := range findings {
+		if finding.Severity == SEVERITY_ERROR {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LintDockerfile returns the problems of the Dockerfile of an agent, ordered
+// by line; the error is only set when it can't be parsed.
+func LintDockerfile(content []byte) ([]Finding, error) {
+	findings := make([]Finding, 0)
+
+	result, err := parser.Parse(bytes.NewReader(content))
+
+	if err != nil {
+		return findings, bettererrors.
+			New("Could not parse Dockerfile").
+			With(bettererrors.NewFromErr(err))
+	}
+
+	forbiddenInstructions, err := dockerfile.DockerfileFindForbiddenInstructions(bytes.NewReader(content))
+
+	if err != nil {
+		return findings, bettererrors.
+			New("Could not check Dockerfile instructions").
+			With(bettererrors.NewFromErr(err))
+	}
+
+	forbidden := make(map[string]bool)
+	for name := range forbiddenInstructions {
+		forbidden[strings.ToLower(name.String())] = true
+	}
+
+	nodes := result.AST.Children
+	stages := make(map[string]bool)
+	reported := make(map[string]bool)
+	commands := make(map[string][]*parser.Node)
+
+	for _, node := range nodes {
+		name := node.Value
+		commands[name] = append(commands[name], node)
+
+		if forbidden[name] {
+			reported[name] = true
+			findings = append(findings, forbiddenFinding(name, node.StartLine))
+		}
+
+		switch name {
+		case command.From:
+			findings = append(findings, lintFrom(node, stages)...)
+		case command.Add:
+			findings = append(findings, lintAdd(node)...)
+		case command.Maintainer:
+			findings = append(findings, Finding{
+				Line:        node.StartLine,
+				Severity:    SEVERITY_INFO,
+				Instruction: "MAINTAINER",
+				Message:     "MAINTAINER is deprecated",
+				Suggestion:  "use LABEL maintainer=\"...\" instead",
+			})
+		}
+	}
+
+	// The parser knows of all the instructions core forbids; this is in case
+	// it doesn't
+	for name := range forbidden {
+		if !reported[name] {
+			findings = append(findings, forbiddenFinding(name, 0))
+		}
+	}
+
+	if len(commands[command.From]) == 0 {
+		findings = append(findings, Finding{
+			Severity:   SEVERITY_ERROR,
+			Message:    "No FROM instruction",
+			Suggestion: "start the Dockerfile with the base image of the agent, e.g. FROM node:8",
+		})
+	}
+
+	if len(commands[command.Cmd]) == 0 && len(commands[command.Entrypoint]) == 0 {
+		findings = append(findings, Finding{
+			Severity:   SEVERITY_WARNING,
+			Message:    "No CMD nor ENTRYPOINT; the agent only starts if the base image defines one",
+			Suggestion: "add a CMD running the agent",
+		})
+	}
+
+	for _, name := range []string{command.Cmd, command.Entrypoint} {
+		overridden := commands[name]
+		if len(overridden) > 0 {
+			overridden = overridden[:len(overridden)-1]
+		}
+
+		for _, node := range overridden {
+			findings = append(findings, Finding{
+				Line:        node.StartLine,
+				Severity:    SEVERITY_WARNING,
+				Instruction: strings.ToUpper(name),
+				Message:     "Only the last " + strings.ToUpper(name) + " is used; this one is overridden",
+				Suggestion:  "remove it",
+			})
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Line < findings[j].Line
+	})
+
+	return findings, nil
+}
+
+func forbiddenFinding(name string, line int) Finding {
+	return Finding{
+		Line:        line,
+		Severity:    SEVERITY_ERROR,
+		Instruction: strings.ToUpper(name),
+		Message:     "Forbidden instruction; agents using it can't be deployed",
+		Suggestion:  "remove the " + strings.ToUpper(name) + " instruction",
+	}
+}
+
+// lintFrom checks that base images are pinned to a version; stages of a
+// multi-stage build are recorded so that they are not taken for images.
+func lintFrom(node *parser.Node, stages map[string]bool) []Finding {
+	findings := make([]Finding, 0)
+
+	args := nodeArgs(node)
+	if len(args) == 0 {
+		return findings
+	}
+
+	image := args[0]
+	isStage := stages[strings.ToLower(image)]
+
+	if len(args) == 3 && strings.ToLower(args[1]) == "as" {
+		stages[strings.ToLower(args[2])] = true
+	}
+
+	// Variables are only known at build time, and digests are pinned
+	if image == "scratch" || isStage || strings.Contains(image, "$") || strings.Contains(image, "@") {
+		return findings
+	}
+
+	tag := ""
+
+	// The last colon may be the port of a registry
+	if i := strings.LastIndex(image, ":"); i >= 0 && !strings.Contains(image[i:], "/") {
+		tag = image[i+1:]
+	}
+
+	if tag == "" || tag == "latest" {
+		findings = append(findings, Finding{
+			Line:        node.StartLine,
+			Severity:    SEVERITY_WARNING,
+			Instruction: "FROM",
+			Message:     "The base image " + image + " is not pinned to a version; the agent may break when it is updated",
+			Suggestion:  "use a tag such as " + strings.TrimSuffix(image, ":latest") + ":<version>",
+		})
+	}
+
+	return findings
+}
+
+// lintAdd suggests COPY for local files; ADD is only needed for URLs and
+// archives to extract.
+func lintAdd(node *parser.Node) []Finding {
+	findings := make([]Finding, 0)
+
+	args := nodeArgs(node)
+	if len(args) < 2 {
+		return findings
+	}
+
+	for _, source := range args[:len(args)-1] {
+		if strings.Contains(source, "://") || isArchive(source) {
+			return findings
+		}
+	}
+
+	findings = append(findings, Finding{
+		Line:        node.StartLine,
+		Severity:    SEVERITY_INFO,
+		Instruction: "ADD",
+		Message:     "ADD is used to copy local files",
+		Suggestion:  "use COPY, which does nothing more",
+	})
+
+	return findings
+}
+
+func nodeArgs(node *parser.Node) []string {
+	args := make([]string, 0)
+
+	for next := node.Next; next != nil; next = next.Next {
+		args = append(args, next.Value)
+	}
+
+	return args
+}
+
+func isArchive(source string) bool {
+	for _, extension := range ARCHIVE_EXTENSIONS {
+		if strings.HasSuffix(strings.ToLower(source), extension) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,100 @@
+package lint
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// summary keeps what the tests check of findings; messages may be reworded.
+func summary(findings []Finding) []string {
+	out := make([]string, 0)
+
+	for _, finding := range findings {
+		out = append(out, fmt.Sprintf("%d %s %s", finding.Line, finding.Severity, finding.Instruction))
+	}
+
+	return out
+}
+
+func TestLintDockerfile(t *testing.T) {
+	tests := []struct {
+		name       string
+		dockerfile string
+		expected   []string
+	}{
+		{
+			name:       "clean",
+			dockerfile: "FROM node:8\nCOPY . /agent\nCMD [\"node\", \"/agent/index.js\"]\n",
+			expected:   []string{},
+		},
+		{
+			name:       "forbidden instruction",
+			dockerfile: "FROM node:8\nVOLUME /data\nCMD node index.js\n",
+			expected:   []string{"2 error VOLUME"},
+		},
+		{
+			name:       "no FROM",
+			dockerfile: "CMD node index.js\n",
+			expected:   []string{"0 error "},
+		},
+		{
+			name:       "unpinned FROM",
+			dockerfile: "FROM node\nCMD node index.js\n",
+			expected:   []string{"1 warning FROM"},
+		},
+		{
+			name:       "latest FROM",
+			dockerfile: "FROM node:latest\nCMD node index.js\n",
+			expected:   []string{"1 warning FROM"},
+		},
+		{
+			name:       "registry port without tag",
+			dockerfile: "FROM localhost:5000/node\nCMD node index.js\n",
+			expected:   []string{"1 warning FROM"},
+		},
+		{
+			name:       "registry port with tag",
+			dockerfile: "FROM localhost:5000/node:8\nCMD node index.js\n",
+			expected:   []string{},
+		},
+		{
+			name:       "digest, variable and scratch",
+			dockerfile: "ARG BASE=node:8\nFROM $BASE\nFROM node@sha256:0123456789abcdef\nFROM scratch\nCMD node index.js\n",
+			expected:   []string{},
+		},
+		{
+			name:       "stages",
+			dockerfile: "FROM node:8 AS builder\nRUN npm install\nFROM builder\nCMD node index.js\n",
+			expected:   []string{},
+		},
+		{
+			name:       "overridden CMD",
+			dockerfile: "FROM node:8\nCMD node old.js\nCMD node index.js\n",
+			expected:   []string{"2 warning CMD"},
+		},
+		{
+			name:       "no CMD",
+			dockerfile: "FROM node:8\n",
+			expected:   []string{"0 warning "},
+		},
+		{
+			name:       "ADD of local files and archives",
+			dockerfile: "FROM node:8\nADD . /agent\nADD deps.tar.gz /deps\nCMD node index.js\n",
+			expected:   []string{"2 info ADD"},
+		},
+	}
+
+	for _, test := range tests {
+		findings, err := LintDockerfile([]byte(test.dockerfile))
+
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", test.name, err)
+			continue
+		}
+
+		if actual := summary(findings); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	bettererrors "github.com/xtuc/better-errors"
+)
+
+const (
+	DOCKER_BUILD_FILE = "Dockerfile"
+	SHOW_USAGE        = true
+	DONT_SHOW_USAGE   = false
+
+	OUTPUT_TEXT = "text"
+	OUTPUT_JSON = "json"
+)
+
+// Main lints the Dockerfile of the agent in dir, and fails when it has
+// errors; warnings are only reported.
+func Main(dir string, output string) (bool, error) {
+	if output != OUTPUT_TEXT && output != OUTPUT_JSON {
+		return SHOW_USAGE, bettererrors.
+			New("Unknown output format; expected text or json").
+			SetContext("output", output)
+	}
+
+	if dir == "" {
+		dir = "."
+	}
+
+	findings, err := LintDir(dir)
+
+	if err != nil {
+		return DONT_SHOW_USAGE, err
+	}
+
+	if output == OUTPUT_JSON {
+		data, _ := json.MarshalIndent(findings, "", "    ")
+		fmt.Println(string(data))
+	} else if len(findings) == 0 {
+		fmt.Println("No problem found in " + path.Join(dir, DOCKER_BUILD_FILE))
+	} else {
+		PrintFindings(os.Stdout, findings)
+	}
+
+	if HasErrors(findings) {
+		return DONT_SHOW_USAGE, bettererrors.
+			New("The Dockerfile has errors").
+			SetContext("directory", dir)
+	}
+
+	return DONT_SHOW_USAGE, nil
+}
+
+// LintDir lints the Dockerfile of the agent in dir.
+func LintDir(dir string) ([]Finding, error) {
+	location := path.Join(dir, DOCKER_BUILD_FILE)
+
+	content, err := ioutil.ReadFile(location)
+
+	if err != nil {
+		return nil, bettererrors.
+			New("Could not read Dockerfile").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("file", location)
+	}
+
+	findings, err := LintDockerfile(content)
+
+	if err != nil {
+		return nil, bettererrors.
+			New("Could not lint Dockerfile").
+			With(err).
+			SetContext("file", location)
+	}
+
+	return findings, nil
+}
+
+func PrintFindings(out io.Writer, findings []Finding) {
+	for _, finding := range findings {
+		fmt.Fprintln(out, finding.String())
+	}
+}
@@ -0,0 +1,276 @@
+package mapcmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	bettererrors "github.com/xtuc/better-errors"
+
+	"github.com/bytearena/ba/humanize"
+	"github.com/bytearena/core/common/utils"
+)
+
+const (
+	// Last time each map was used, to prune the unused ones
+	MAP_USAGE_FILENAME = "usage.json"
+)
+
+type mapUsageType map[string]time.Time
+
+func getMapUsagePath() (string, error) {
+	mapsDir, err := utils.GetTrainerMapsDir()
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(mapsDir, MAP_USAGE_FILENAME), nil
+}
+
+func getMapUsage() mapUsageType {
+	usage := make(mapUsageType)
+
+	usagePath, err := getMapUsagePath()
+	if err != nil {
+		return usage
+	}
+
+	data, err := ioutil.ReadFile(usagePath)
+	if err != nil {
+		return usage
+	}
+
+	json.Unmarshal(data, &usage)
+
+	return usage
+}
+
+func persistMapUsage(usage mapUsageType) error {
+	usagePath, err := getMapUsagePath()
+	if err != nil {
+		return err
+	}
+
+	data, _ := json.MarshalIndent(usage, "", "    ")
+
+	err = ioutil.WriteFile(usagePath, data, 0644)
+	if err != nil {
+		return bettererrors.
+			New("Could not persist the map usage").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("location", usagePath)
+	}
+
+	return nil
+}
+
+// RecordMapUsage remembers that a map of the cache has just been used; local
+// maps given by path are not tracked.
+func RecordMapUsage(mapname string) error {
+	if IsMapPath(mapname) {
+		return nil
+	}
+
+	usage := getMapUsage()
+	usage[mapname] = time.Now()
+
+	return persistMapUsage(usage)
+}
+
+type cachedMapFile struct {
+	Name     string
+	Location string
+	Size     int64
+	Reason   string
+}
+
+type MapRemoveActionArguments struct {
+	Names  []string
+	DryRun bool
+}
+
+// MapRemoveAction deletes maps from the cache. They stay in the manifest,
+// and are fetched again by the next `map update`.
+func MapRemoveAction(args MapRemoveActionArguments) error {
+	if len(args.Names) == 0 {
+		return bettererrors.New("No map was specified")
+	}
+
+	files := make([]cachedMapFile, 0)
+
+	for _, name := range args.Names {
+		// Names are joined to the maps directory; they must not leave it
+		if !isValidMapName(name) {
+			return bettererrors.
+				New("Invalid map name").
+				SetContext("map", name)
+		}
+
+		found := false
+
+		for _, location := range []string{GetMapLocation(name), GetMapLocation(name) + MAP_DOWNLOAD_PART_SUFFIX} {
+			info, err := os.Stat(location)
+			if err != nil {
+				continue
+			}
+
+			found = true
+			files = append(files, cachedMapFile{
+				Name:     name,
+				Location: location,
+				Size:     info.Size(),
+				Reason:   "removed",
+			})
+		}
+
+		if !found {
+			return bettererrors.
+				New("Map is not in the local cache").
+				SetContext("map", name)
+		}
+	}
+
+	return deleteCachedMapFiles(files, args.DryRun)
+}
+
+func isValidMapName(name string) bool {
+	return name != "" &&
+		name != "." &&
+		!strings.Contains(name, "..") &&
+		!strings.ContainsAny(name, "/\\")
+}
+
+type MapPruneActionArguments struct {
+	UnusedDays int
+	DryRun     bool
+}
+
+// MapPruneAction deletes the maps no longer in the manifest, the leftovers
+// of interrupted downloads and imports and, if UnusedDays is set, the maps
+// not used since then. Maps never used count from when they were downloaded.
+func MapPruneAction(args MapPruneActionArguments) error {
+	if args.UnusedDays < 0 {
+		return bettererrors.New("The number of days must be positive")
+	}
+
+	mapsDir, err := utils.GetTrainerMapsDir()
+	if err != nil {
+		return err
+	}
+
+	manifest, err := getLocalMapManifest()
+	if err != nil {
+		return bettererrors.
+			New("No manifest is available locally. Please run the `map update` command first.").
+			With(bettererrors.NewFromErr(err))
+	}
+
+	inManifest := make(map[string]bool)
+	for _, mapbundle := range manifest.Maps {
+		inManifest[mapbundle.Name] = true
+	}
+
+	usage := getMapUsage()
+	limit := time.Now().AddDate(0, 0, -args.UnusedDays)
+
+	entries, err := ioutil.ReadDir(mapsDir)
+	if err != nil {
+		return bettererrors.
+			New("Could not read the maps directory").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("location", mapsDir)
+	}
+
+	files := make([]cachedMapFile, 0)
+
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() {
+			continue
+		}
+
+		filename := entry.Name()
+		location := path.Join(mapsDir, filename)
+
+		reason := ""
+
+		switch {
+		case strings.HasSuffix(filename, MAP_DOWNLOAD_PART_SUFFIX):
+			reason = "interrupted download"
+
+		case strings.HasSuffix(filename, MAP_IMPORT_SUFFIX):
+			reason = "interrupted import"
+
+		case strings.HasSuffix(filename, ".zip"):
+			name := strings.TrimSuffix(filename, ".zip")
+
+			lastUsed, ok := usage[name]
+			if !ok {
+				lastUsed = entry.ModTime()
+			}
+
+			if !inManifest[name] {
+				reason = "not in the manifest"
+			} else if args.UnusedDays > 0 && lastUsed.Before(limit) {
+				reason = "last used " + lastUsed.Format("2006-01-02")
+			}
+		}
+
+		if reason != "" {
+			files = append(files, cachedMapFile{
+				Name:     filename,
+				Location: location,
+				Size:     entry.Size(),
+				Reason:   reason,
+			})
+		}
+	}
+
+	if len(files) == 0 {
+		fmt.Println("Nothing to prune.")
+		return nil
+	}
+
+	return deleteCachedMapFiles(files, args.DryRun)
+}
+
+func deleteCachedMapFiles(files []cachedMapFile, dryRun bool) error {
+	sort.Slice(files, func(i, j int) bool { return files[i].Location < files[j].Location })
+
+	var freed int64
+	usage := getMapUsage()
+
+	for _, file := range files {
+		if dryRun {
+			fmt.Println(fmt.Sprintf("Would delete %s (%s, %s)", file.Location, humanize.Size(file.Size), file.Reason))
+		} else {
+			if err := os.Remove(file.Location); err != nil {
+				return bettererrors.
+					New("Could not delete map").
+					With(bettererrors.NewFromErr(err)).
+					SetContext("location", file.Location)
+			}
+
+			delete(usage, strings.TrimSuffix(path.Base(file.Location), ".zip"))
+
+			fmt.Println(fmt.Sprintf("Deleted %s (%s, %s)", file.Location, humanize.Size(file.Size), file.Reason))
+		}
+
+		freed += file.Size
+	}
+
+	fmt.Println("")
+
+	if dryRun {
+		fmt.Printf("%s would be freed.\n", humanize.Size(freed))
+		return nil
+	}
+
+	fmt.Printf("[OK] %s freed.\n", humanize.Size(freed))
+
+	return persistMapUsage(usage)
+}
@@ -0,0 +1,26 @@
+package mapcmd
+
+import "testing"
+
+func TestIsValidMapName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{name: "hexagon", expected: true},
+		{name: "death-valley.v2", expected: true},
+		{name: "", expected: false},
+		{name: ".", expected: false},
+		{name: "..", expected: false},
+		{name: "../manifest", expected: false},
+		{name: "deathmatch/hexagon", expected: false},
+		{name: "..\\manifest", expected: false},
+		{name: "/etc/passwd", expected: false},
+	}
+
+	for _, test := range tests {
+		if actual := isValidMapName(test.name); actual != test.expected {
+			t.Errorf("%q: expected %v, got %v", test.name, test.expected, actual)
+		}
+	}
+}
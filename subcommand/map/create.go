@@ -0,0 +1,246 @@
+package mapcmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bettererrors "github.com/xtuc/better-errors"
+
+	"github.com/bytearena/core/common/types/mapcontainer"
+)
+
+const (
+	MAP_README_FILENAME  = "README.md"
+	MAP_PREVIEW_FILENAME = "preview.svg"
+	MAP_TEMPLATE_SIZE    = 40.0
+)
+
+// MapCreateAction scaffolds the directory of a new map pack, holding a small
+// square arena to start from, which passes `ba map validate`, and its
+// preview.
+func MapCreateAction(dir string) error {
+	if dir == "" {
+		return bettererrors.New("No map name was specified")
+	}
+
+	if _, err := os.Stat(dir); err == nil {
+		return bettererrors.
+			New("Destination already exists").
+			SetContext("directory", dir)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return bettererrors.
+			New("Could not create map directory").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("directory", dir)
+	}
+
+	name := filepath.Base(filepath.Clean(dir))
+	template := getMapTemplate()
+	data, _ := json.MarshalIndent(template, "", "    ")
+
+	if err := ioutil.WriteFile(filepath.Join(dir, MAP_JSON_FILENAME), data, 0644); err != nil {
+		return bettererrors.
+			New("Could not write map.json").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("directory", dir)
+	}
+
+	bounds, _ := getBounds(&template)
+	preview := renderMapSvg(&template, bounds)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, MAP_PREVIEW_FILENAME), []byte(preview), 0644); err != nil {
+		return bettererrors.
+			New("Could not write preview.svg").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("directory", dir)
+	}
+
+	readme := fmt.Sprintf("# %s\n\nA Byte Arena map.\n\n![%s](%s)\n", name, name, MAP_PREVIEW_FILENAME)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, MAP_README_FILENAME), []byte(readme), 0644); err != nil {
+		return bettererrors.
+			New("Could not write README.md").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("directory", dir)
+	}
+
+	fmt.Println(dir, "has been created")
+	fmt.Println("")
+	mappath := filepath.Clean(dir)
+	if !IsMapPath(mappath) {
+		mappath = "./" + mappath
+	}
+
+	fmt.Printf("Edit %s, then try it with `ba train --map %s`\n", filepath.Join(dir, MAP_JSON_FILENAME), mappath)
+	fmt.Printf("and package it with `ba map pack %s`; `ba map show --svg %s %s`\n", dir, filepath.Join(dir, MAP_PREVIEW_FILENAME), mappath)
+	fmt.Println("updates its preview.")
+
+	return nil
+}
+
+func getMapTemplate() mapcontainer.MapContainer {
+	var template mapcontainer.MapContainer
+
+	size := MAP_TEMPLATE_SIZE
+	center := size / 2
+
+	template.Meta.Readme = MAP_README_FILENAME
+	template.Meta.Kind = "deathmatch"
+	template.Meta.MaxContestants = 4
+	template.Meta.Date = time.Now().Format(time.RFC3339)
+
+	template.Data.Grounds = []mapcontainer.MapGround{
+		{
+			Name: "ground",
+			Outline: []mapcontainer.MapPolygon{
+				{Points: []mapcontainer.MapPoint{{0, 0}, {size, 0}, {size, size}, {0, size}}},
+			},
+		},
+	}
+
+	template.Data.Starts = []mapcontainer.MapStart{
+		{Name: "start-1", Point: mapcontainer.MapPoint{5, 5}},
+		{Name: "start-2", Point: mapcontainer.MapPoint{size - 5, 5}},
+		{Name: "start-3", Point: mapcontainer.MapPoint{size - 5, size - 5}},
+		{Name: "start-4", Point: mapcontainer.MapPoint{5, size - 5}},
+	}
+
+	template.Data.Obstacles = []mapcontainer.MapObstacleObject{
+		{
+			Name: "pillar",
+			Polygon: mapcontainer.MapPolygon{
+				Points: []mapcontainer.MapPoint{
+					{center - 2, center - 2},
+					{center + 2, center - 2},
+					{center + 2, center + 2},
+					{center - 2, center + 2},
+				},
+			},
+		},
+	}
+
+	return template
+}
+
+type MapPackActionArguments struct {
+	Dir     string
+	Output  string
+	BaseUrl string
+	Title   string
+	Comment string
+}
+
+// MapPackAction zips a map directory once it is valid, and prints the entry
+// to add to a manifest for it.
+func MapPackAction(args MapPackActionArguments) error {
+	if args.Dir == "" {
+		return bettererrors.New("No map directory was specified")
+	}
+
+	if info, err := os.Stat(args.Dir); err != nil || !info.IsDir() {
+		return bettererrors.
+			New("Map directory does not exist").
+			SetContext("directory", args.Dir)
+	}
+
+	dir, err := filepath.Abs(args.Dir)
+	if err != nil {
+		return bettererrors.NewFromErr(err)
+	}
+
+	name := filepath.Base(dir)
+
+	// Next to the directory rather than in it, not to zip the zip
+	if args.Output == "" {
+		args.Output = filepath.Join(filepath.Dir(dir), name+".zip")
+	}
+
+	if args.Title == "" {
+		args.Title = name
+	}
+
+	file, err := os.Create(args.Output)
+
+	if err != nil {
+		return bettererrors.
+			New("Could not create map pack").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("location", args.Output)
+	}
+
+	// The output may be in the directory; it is left out of the zip
+	info, err := file.Stat()
+
+	if err == nil {
+		err = writeMapZip(file, dir, info)
+	}
+
+	file.Close()
+
+	if err != nil {
+		os.Remove(args.Output)
+
+		return bettererrors.
+			New("Could not zip map directory").
+			With(err).
+			SetContext("directory", args.Dir)
+	}
+
+	problems, err := validateMapFile(args.Output)
+
+	if err == nil && len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Println(problem.String())
+		}
+
+		err = bettererrors.
+			New("Map is not valid").
+			SetContext("map", args.Dir).
+			SetContext("problems", fmt.Sprintf("%d", len(problems)))
+	}
+
+	if err != nil {
+		os.Remove(args.Output)
+		return err
+	}
+
+	checksum, err := getFileMd5(args.Output)
+	if err != nil {
+		return err
+	}
+
+	sha256sum, err := getFileSha256(args.Output)
+	if err != nil {
+		return err
+	}
+
+	url := filepath.Base(args.Output)
+	if args.BaseUrl != "" {
+		url = strings.TrimSuffix(args.BaseUrl, "/") + "/" + url
+	}
+
+	entry := mapBundleType{
+		Md5:     checksum,
+		Sha256:  sha256sum,
+		Url:     url,
+		Name:    name,
+		Title:   args.Title,
+		Comment: args.Comment,
+	}
+
+	data, _ := json.MarshalIndent(entry, "", "    ")
+
+	fmt.Printf("[OK] Map packed in %s\n", args.Output)
+	fmt.Println("")
+	fmt.Println("Manifest entry:")
+	fmt.Println(string(data))
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package mapcmd
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMapTemplateIsValid(t *testing.T) {
+	template := getMapTemplate()
+	data, _ := json.Marshal(template)
+
+	problems := validateMapSchema(data)
+	problems = append(problems, validateMapGeometry(&template)...)
+
+	for _, problem := range problems {
+		t.Errorf("template: %s", problem.String())
+	}
+}
+
+func TestWriteMapZipSkipsOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ba-map-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, MAP_JSON_FILENAME), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(dir, "map.zip")
+
+	file, err := os.Create(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, _ := file.Stat()
+	err = writeMapZip(file, dir, info)
+	file.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := zip.OpenReader(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer reader.Close()
+
+	if len(reader.File) != 1 || reader.File[0].Name != MAP_JSON_FILENAME {
+		names := make([]string, 0)
+		for _, f := range reader.File {
+			names = append(names, f.Name)
+		}
+
+		t.Errorf("expected only %s in the zip, got %v", MAP_JSON_FILENAME, names)
+	}
+}
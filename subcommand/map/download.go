@@ -0,0 +1,173 @@
+package mapcmd
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/cheggaaa/pb"
+	bettererrors "github.com/xtuc/better-errors"
+)
+
+const (
+	// Downloads are written next to the map pack, so that they can be resumed
+	// and moved into place atomically
+	MAP_DOWNLOAD_PART_SUFFIX = ".part"
+
+	MAP_DOWNLOAD_DEFAULT_JOBS = 4
+)
+
+// DownloadMaps downloads the given map packs concurrently, using at most jobs
+// downloads at a time. The returned errors are in the order of the maps.
+func DownloadMaps(mapbundles []mapBundleType, jobs int) []error {
+	errs := make([]error, len(mapbundles))
+
+	if len(mapbundles) == 0 {
+		return errs
+	}
+
+	if jobs <= 0 {
+		jobs = MAP_DOWNLOAD_DEFAULT_JOBS
+	}
+
+	pool, err := pb.StartPool()
+	if err != nil {
+		for i := range errs {
+			errs[i] = bettererrors.NewFromErr(err)
+		}
+
+		return errs
+	}
+
+	queue := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range queue {
+				errs[i] = downloadMap(mapbundles[i], pool)
+			}
+		}()
+	}
+
+	for i := range mapbundles {
+		queue <- i
+	}
+
+	close(queue)
+	wg.Wait()
+
+	pool.Stop()
+
+	return errs
+}
+
+func DownloadMap(mapbundle mapBundleType) error {
+	return DownloadMaps([]mapBundleType{mapbundle}, 1)[0]
+}
+
+func downloadMap(mapbundle mapBundleType, pool *pb.Pool) error {
+	destination := GetMapLocation(mapbundle.Name)
+	part := destination + MAP_DOWNLOAD_PART_SUFFIX
+
+	resumed, err := fetchMapPart(mapbundle, part, pool)
+
+	if err == nil {
+		err = verifyMapFile(mapbundle, part)
+
+		// The partial download may have been of a previous version of the map
+		if err != nil && resumed {
+			os.Remove(part)
+
+			_, err = fetchMapPart(mapbundle, part, pool)
+			if err == nil {
+				err = verifyMapFile(mapbundle, part)
+			}
+		}
+
+		// Refuse to install content that does not match the manifest
+		if err != nil {
+			os.Remove(part)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(part, destination); err != nil {
+		return bettererrors.
+			New("Could not move map pack into place").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("name", mapbundle.Name).
+			SetContext("location", destination)
+	}
+
+	return nil
+}
+
+// fetchMapPart downloads a map pack into part, resuming from what part
+// already holds when the source allows it. An interrupted download leaves
+// part in place for the next attempt.
+func fetchMapPart(mapbundle mapBundleType, part string, pool *pb.Pool) (bool, error) {
+	var offset int64
+
+	if info, err := os.Stat(part); err == nil {
+		offset = info.Size()
+	}
+
+	body, size, start, err := openSourceAt(mapbundle.Url, offset)
+
+	if err != nil {
+		return false, bettererrors.
+			New("Could not get map "+mapbundle.Name).
+			With(err).
+			SetContext("url", mapbundle.Url)
+	}
+
+	defer body.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if start == 0 {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(part, flags, 0644)
+
+	if err != nil {
+		return false, bettererrors.
+			New("Could not open destination file for map").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("name", mapbundle.Name).
+			SetContext("location", part)
+	}
+
+	defer file.Close()
+
+	if size < 0 {
+		size = 0
+	}
+
+	bar := pb.New64(size).
+		Set("prefix", mapbundle.Name+" ").
+		Set(pb.Bytes, true).
+		SetWidth(80).
+		SetCurrent(start)
+	pool.Add(bar)
+
+	_, err = io.Copy(file, bar.NewProxyReader(body))
+	bar.Finish()
+
+	if err != nil {
+		return start > 0, bettererrors.
+			New("Could not download map "+mapbundle.Name).
+			With(bettererrors.NewFromErr(err)).
+			SetContext("url", mapbundle.Url)
+	}
+
+	return start > 0, nil
+}
@@ -0,0 +1,399 @@
+package mapcmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	bettererrors "github.com/xtuc/better-errors"
+)
+
+const (
+	MAP_EXPORT_MANIFEST_ENTRY = "manifest.json"
+
+	// Suffix of the map packs being imported, until they are verified
+	MAP_IMPORT_SUFFIX = ".import"
+)
+
+func isGzipArchive(filename string) bool {
+	return strings.HasSuffix(filename, ".tar.gz") || strings.HasSuffix(filename, ".tgz")
+}
+
+// MapExportAction bundles the local manifest and map packs in a tar archive,
+// to be installed with MapImportAction on machines without internet access.
+func MapExportAction(out string) error {
+	if out == "" {
+		return bettererrors.New("No destination archive was specified")
+	}
+
+	manifest, err := getLocalMapManifest()
+	if err != nil {
+		return bettererrors.
+			New("No maps are available locally. Please run the `map update` command first.").
+			With(bettererrors.NewFromErr(err))
+	}
+
+	file, err := os.Create(out)
+	if err != nil {
+		return bettererrors.
+			New("Could not create archive").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("location", out)
+	}
+
+	var w io.Writer = file
+	var gw *gzip.Writer
+
+	if isGzipArchive(out) {
+		gw = gzip.NewWriter(file)
+		w = gw
+	}
+
+	tw := tar.NewWriter(w)
+
+	exported := manifestType{Maps: make([]mapBundleType, 0)}
+	files := make([]string, 0)
+
+	for _, mapbundle := range manifest.Maps {
+		checksum, err := GetLocalMapChecksum(mapbundle)
+
+		if err != nil || !strings.EqualFold(checksum, mapbundle.getChecksum()) {
+			fmt.Println(fmt.Sprintf("Map \"%s\" is missing or outdated locally; skipped.", mapbundle.Name))
+			continue
+		}
+
+		exported.Maps = append(exported.Maps, mapbundle)
+		files = append(files, GetMapLocation(mapbundle.Name))
+	}
+
+	// The manifest goes first so that imports know what to expect
+	data, _ := json.MarshalIndent(exported, "", "    ")
+	err = writeTarEntry(tw, MAP_EXPORT_MANIFEST_ENTRY, int64(len(data)), strings.NewReader(string(data)))
+
+	for _, filename := range files {
+		if err != nil {
+			break
+		}
+
+		err = writeTarFile(tw, filename)
+	}
+
+	if err == nil {
+		err = tw.Close()
+	}
+
+	if err == nil && gw != nil {
+		err = gw.Close()
+	}
+
+	file.Close()
+
+	if err != nil {
+		os.Remove(out)
+
+		return bettererrors.
+			New("Could not write archive").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("location", out)
+	}
+
+	fmt.Printf("[OK] %d maps exported to %s\n", len(exported.Maps), out)
+
+	return nil
+}
+
+func writeTarFile(tw *tar.Writer, filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	return writeTarEntry(tw, path.Base(filename), info.Size(), file)
+}
+
+func writeTarEntry(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name: name,
+		Mode: 0644,
+		Size: size,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tw, r)
+
+	return err
+}
+
+type MapImportActionArguments struct {
+	In string
+
+	// Manifests the maps are verified against, signed with one of the
+	// public keys when given; the local manifest is used if there are none
+	ManifestSources []string
+	PublicKeyFiles  []string
+
+	// Install the maps missing from the trusted manifests, only checked
+	// against the manifest of the archive
+	Unverified bool
+}
+
+// MapImportAction installs the maps of an archive made by MapExportAction,
+// once their checksums are verified against a trusted manifest; the
+// manifest of the archive only tells what it holds. The maps are added to
+// the local manifest, replacing those with the same name.
+func MapImportAction(args MapImportActionArguments) error {
+	in := args.In
+
+	if in == "" {
+		return bettererrors.New("No archive was specified")
+	}
+
+	trusted, err := getTrustedManifest(args.ManifestSources, args.PublicKeyFiles)
+
+	if err != nil && !args.Unverified {
+		return bettererrors.
+			New("No trusted manifest to verify the maps against; give one with --manifest, or import them with --unverified").
+			With(err)
+	}
+
+	if err := ensureMapDir(); err != nil {
+		return err
+	}
+
+	file, err := os.Open(in)
+	if err != nil {
+		return bettererrors.
+			New("Could not open archive").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("location", in)
+	}
+
+	defer file.Close()
+
+	var r io.Reader = file
+
+	if isGzipArchive(in) {
+		gr, err := gzip.NewReader(file)
+		if err != nil {
+			return bettererrors.
+				New("Could not read archive").
+				With(bettererrors.NewFromErr(err)).
+				SetContext("location", in)
+		}
+
+		defer gr.Close()
+		r = gr
+	}
+
+	var imported *manifestType
+	extracted := make(map[string]string)
+
+	defer func() {
+		for _, filename := range extracted {
+			os.Remove(filename)
+		}
+	}()
+
+	tr := tar.NewReader(r)
+
+	for {
+		header, err := tr.Next()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return bettererrors.
+				New("Could not read archive").
+				With(bettererrors.NewFromErr(err)).
+				SetContext("location", in)
+		}
+
+		name := path.Clean(header.Name)
+
+		switch {
+		case name == MAP_EXPORT_MANIFEST_ENTRY:
+			data, err := ioutil.ReadAll(tr)
+
+			if err == nil {
+				imported = &manifestType{}
+				err = json.Unmarshal(data, imported)
+			}
+
+			if err != nil {
+				return bettererrors.
+					New("Could not parse the manifest of the archive").
+					With(bettererrors.NewFromErr(err)).
+					SetContext("location", in)
+			}
+
+		case path.Ext(name) == ".zip" && path.Dir(name) == ".":
+			mapname := strings.TrimSuffix(name, ".zip")
+			destination := GetMapLocation(mapname) + MAP_IMPORT_SUFFIX
+
+			extracted[mapname] = destination
+
+			if err := extractTarEntry(tr, destination); err != nil {
+				return bettererrors.
+					New("Could not extract map "+mapname).
+					With(bettererrors.NewFromErr(err)).
+					SetContext("location", destination)
+			}
+		}
+	}
+
+	if imported == nil {
+		return bettererrors.
+			New("Archive has no manifest; was it made by `ba map export`?").
+			SetContext("location", in)
+	}
+
+	installed := make([]mapBundleType, 0)
+
+	trustedBundles := make(map[string]mapBundleType)
+
+	for _, mapbundle := range trusted.Maps {
+		trustedBundles[mapbundle.Name] = mapbundle
+	}
+
+	for _, mapbundle := range imported.Maps {
+		filename, ok := extracted[mapbundle.Name]
+
+		if !ok {
+			fmt.Println(fmt.Sprintf("[ERROR] Map \"%s\" is missing from the archive", mapbundle.Name))
+			continue
+		}
+
+		trustedBundle, isTrusted := trustedBundles[mapbundle.Name]
+
+		if !isTrusted && !args.Unverified {
+			fmt.Println(fmt.Sprintf("[ERROR] Map \"%s\" is not in the trusted manifests; give its manifest with --manifest, or import it with --unverified", mapbundle.Name))
+			continue
+		}
+
+		if isTrusted {
+			mapbundle = trustedBundle
+		} else {
+			mapbundle.Unverified = true
+		}
+
+		if err := verifyMapFile(mapbundle, filename); err != nil {
+			fmt.Println(fmt.Sprintf("[ERROR] Map \"%s\" could not be verified: %s", mapbundle.Name, err.Error()))
+			continue
+		}
+
+		if err := os.Rename(filename, GetMapLocation(mapbundle.Name)); err != nil {
+			return bettererrors.
+				New("Could not move map pack into place").
+				With(bettererrors.NewFromErr(err)).
+				SetContext("name", mapbundle.Name)
+		}
+
+		delete(extracted, mapbundle.Name)
+		installed = append(installed, mapbundle)
+
+		if isTrusted {
+			fmt.Println(fmt.Sprintf("[OK] Map \"%s\" verified and imported!", mapbundle.Name))
+		} else {
+			fmt.Println(fmt.Sprintf("[WARN] Map \"%s\" imported without verification; it only matches the manifest of the archive", mapbundle.Name))
+		}
+	}
+
+	if err := persistLocalMapManifest(mergeManifests(installed)); err != nil {
+		return err
+	}
+
+	if len(installed) < len(imported.Maps) {
+		return bettererrors.
+			New("Some maps could not be imported").
+			SetContext("failed", fmt.Sprintf("%d", len(imported.Maps)-len(installed)))
+	}
+
+	return nil
+}
+
+// getTrustedManifest fetches the manifests the maps of an archive are
+// verified against, or reads the local one, which was verified when fetched.
+func getTrustedManifest(sources []string, publicKeyFiles []string) (manifestType, error) {
+	if len(sources) == 0 {
+		local, err := getLocalMapManifest()
+		if err != nil {
+			return local, err
+		}
+
+		trusted := manifestType{Maps: make([]mapBundleType, 0)}
+
+		for _, mapbundle := range local.Maps {
+			if !mapbundle.Unverified {
+				trusted.Maps = append(trusted.Maps, mapbundle)
+			}
+		}
+
+		return trusted, nil
+	}
+
+	publicKeys, err := LoadManifestPublicKeys(publicKeyFiles)
+	if err != nil {
+		return manifestType{}, err
+	}
+
+	return FetchManifests(GetManifestSources(sources), publicKeys)
+}
+
+// mergeManifests adds maps to the local manifest, replacing the maps of the
+// same name.
+func mergeManifests(mapbundles []mapBundleType) manifestType {
+	manifest, err := getLocalMapManifest()
+	if err != nil {
+		manifest = manifestType{}
+	}
+
+	merged := manifestType{Maps: make([]mapBundleType, 0)}
+	replaced := make(map[string]bool)
+
+	for _, mapbundle := range mapbundles {
+		replaced[mapbundle.Name] = true
+	}
+
+	for _, mapbundle := range manifest.Maps {
+		if !replaced[mapbundle.Name] {
+			merged.Maps = append(merged.Maps, mapbundle)
+		}
+	}
+
+	merged.Maps = append(merged.Maps, mapbundles...)
+
+	return merged
+}
+
+func extractTarEntry(r io.Reader, destination string) error {
+	file, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, r)
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
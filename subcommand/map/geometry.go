@@ -0,0 +1,49 @@
+package mapcmd
+
+import (
+	"math"
+
+	"github.com/bytearena/core/common/types/mapcontainer"
+)
+
+func polygonArea(points []mapcontainer.MapPoint) float64 {
+	area := 0.0
+
+	for i := range points {
+		j := (i + 1) % len(points)
+		area += points[i][0]*points[j][1] - points[j][0]*points[i][1]
+	}
+
+	return math.Abs(area) / 2
+}
+
+// isPointInPolygon uses the even-odd rule; polygons are implicitly closed.
+func isPointInPolygon(point mapcontainer.MapPoint, points []mapcontainer.MapPoint) bool {
+	inside := false
+
+	for i, j := 0, len(points)-1; i < len(points); j, i = i, i+1 {
+		a, b := points[i], points[j]
+
+		if (a[1] > point[1]) != (b[1] > point[1]) &&
+			point[0] < (b[0]-a[0])*(point[1]-a[1])/(b[1]-a[1])+a[0] {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
+
+func distance(a, b mapcontainer.MapPoint) float64 {
+	return math.Hypot(a[0]-b[0], a[1]-b[1])
+}
+
+// countDistinctPoints ignores the closing point of explicitly closed polygons.
+func countDistinctPoints(points []mapcontainer.MapPoint) int {
+	seen := make(map[mapcontainer.MapPoint]bool)
+
+	for _, point := range points {
+		seen[point] = true
+	}
+
+	return len(seen)
+}
@@ -0,0 +1,195 @@
+package mapcmd
+
+import (
+	"archive/zip"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	bettererrors "github.com/xtuc/better-errors"
+)
+
+// IsMapPath tells whether the map given to --map is a local directory or zip
+// file rather than the name of a map of the manifest.
+func IsMapPath(mapname string) bool {
+	return strings.HasSuffix(mapname, ".zip") ||
+		strings.ContainsRune(mapname, '/') ||
+		strings.ContainsRune(mapname, os.PathSeparator) ||
+		strings.HasPrefix(mapname, ".")
+}
+
+// GetMapName returns the name of a map, which is the base name of its
+// directory or zip file for local maps.
+func GetMapName(mapname string) string {
+	if !IsMapPath(mapname) {
+		return mapname
+	}
+
+	return strings.TrimSuffix(filepath.Base(filepath.Clean(mapname)), ".zip")
+}
+
+// ResolveMapLocation returns the location of the zip of a map given either by
+// name or by path. Map directories are zipped in a temporary file, each time
+// they are resolved so that changes are picked up; release removes it once
+// the map is loaded.
+func ResolveMapLocation(mapname string) (location string, release func(), err error) {
+	release = func() {}
+
+	if !IsMapPath(mapname) {
+		return GetMapLocation(mapname), release, nil
+	}
+
+	info, err := os.Stat(mapname)
+
+	if err != nil {
+		return "", release, bettererrors.
+			New("Could not find map").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("path", mapname)
+	}
+
+	if !info.IsDir() {
+		return mapname, release, nil
+	}
+
+	location, err = zipMapDir(mapname)
+	if err != nil {
+		return "", release, err
+	}
+
+	return location, func() { os.Remove(location) }, nil
+}
+
+func zipMapDir(dir string) (string, error) {
+	absdir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", bettererrors.NewFromErr(err)
+	}
+
+	file, err := ioutil.TempFile("", "bamap-")
+
+	if err != nil {
+		return "", bettererrors.
+			New("Could not create map zip").
+			With(bettererrors.NewFromErr(err))
+	}
+
+	defer file.Close()
+
+	if err := writeMapZip(file, absdir, nil); err != nil {
+		os.Remove(file.Name())
+
+		return "", bettererrors.
+			New("Could not zip map directory").
+			With(err).
+			SetContext("directory", dir)
+	}
+
+	return file.Name(), nil
+}
+
+// writeMapZip zips the files of dir; skip is the zip itself when it is
+// written in dir.
+func writeMapZip(out io.Writer, dir string, skip os.FileInfo) error {
+	zw := zip.NewWriter(out)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() || (skip != nil && os.SameFile(info, skip)) {
+			return nil
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+
+		header.Name = filepath.ToSlash(name)
+		header.Method = zip.Deflate
+
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(data)
+
+		return err
+	})
+
+	if err != nil {
+		return bettererrors.NewFromErr(err)
+	}
+
+	return zw.Close()
+}
+
+// GetMapChecksum returns the checksum of a map given either by name or by
+// path; named maps are checked as by `ba map list`.
+func GetMapChecksum(mapname string, location string) (string, error) {
+	if IsMapPath(mapname) {
+		return getFileMd5(location)
+	}
+
+	bundle := mapBundleType{Name: mapname}
+
+	// Without a local manifest, the map can only be checked in MD5
+	if manifest, err := getLocalMapManifest(); err == nil {
+		for _, mapbundle := range manifest.Maps {
+			if mapbundle.Name == mapname {
+				bundle = mapbundle
+			}
+		}
+	}
+
+	return GetLocalMapChecksum(bundle)
+}
+
+func getFileMd5(filename string) (string, error) {
+	return getFileDigest(filename, md5.New())
+}
+
+func getFileSha256(filename string) (string, error) {
+	return getFileDigest(filename, sha256.New())
+}
+
+func getFileDigest(filename string, h hash.Hash) (string, error) {
+	file, err := os.Open(filename)
+
+	if err != nil {
+		return "", bettererrors.
+			New("Could not open file").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("file", filename)
+	}
+
+	defer file.Close()
+
+	if _, err := io.Copy(h, file); err != nil {
+		return "", bettererrors.
+			New("Could not read file").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("file", filename)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
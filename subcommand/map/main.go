@@ -1,20 +1,17 @@
 package mapcmd
 
 import (
-	"crypto/md5"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
-	"log"
-	"net/http"
 	"os"
 	"path"
+	"strings"
+	"text/tabwriter"
 
-	"github.com/cheggaaa/pb"
 	bettererrors "github.com/xtuc/better-errors"
 
+	"github.com/bytearena/ba/humanize"
 	"github.com/bytearena/core/common/utils"
 )
 
@@ -23,66 +20,190 @@ const (
 )
 
 type mapBundleType struct {
+	// Md5 is only checked when the manifest gives no SHA-256 digest
 	Md5     string `json:"md5"`
+	Sha256  string `json:"sha256,omitempty"`
 	Url     string `json:"url"`
 	Name    string `json:"name"`
 	Title   string `json:"title"`
 	Comment string `json:"comment"`
+
+	// Manifest the map comes from; only set in the local manifest
+	Source string `json:"source,omitempty"`
+
+	// Imported with `map import --unverified`; not trusted by later imports
+	Unverified bool `json:"unverified,omitempty"`
 }
 
 type manifestType struct {
 	Maps []mapBundleType `json:"maps"`
 }
 
-func MapListAction() {
+const (
+	MAP_LIST_FORMAT_TEXT  = "text"
+	MAP_LIST_FORMAT_TABLE = "table"
+	MAP_LIST_FORMAT_JSON  = "json"
+)
+
+// MapInfo is the state of a map of the local manifest.
+type MapInfo struct {
+	Name     string `json:"name"`
+	Title    string `json:"title"`
+	Comment  string `json:"comment"`
+	Url      string `json:"url"`
+	Source   string `json:"source,omitempty"`
+	Checksum string `json:"checksum"`
+
+	// Location and Size are only set once the map is downloaded
+	Location   string `json:"location,omitempty"`
+	Size       int64  `json:"size"`
+	Downloaded bool   `json:"downloaded"`
+	UpToDate   bool   `json:"uptodate"`
+	Pinned     string `json:"pinned,omitempty"`
+}
 
+// GetMapList returns the state of the maps of the local manifest.
+func GetMapList() ([]MapInfo, error) {
 	err := ensureMapDir()
 	if err != nil {
-		utils.FailWith(err)
+		return nil, err
 	}
 
 	manifest, err := getLocalMapManifest()
 	if err != nil {
-		fmt.Println("No maps are available locally. Please run the `map update` command first.")
-		os.Exit(1)
+		return nil, bettererrors.
+			New("No maps are available locally. Please run the `map update` command first.").
+			With(bettererrors.NewFromErr(err))
 	}
 
-	someOutdated := false
-	someMissing := false
+	pins, err := getMapPins()
+	if err != nil {
+		return nil, err
+	}
 
-	fmt.Printf("%d maps in manifest.\n", len(manifest.Maps))
-	fmt.Println("")
+	maps := make([]MapInfo, 0)
 
 	for _, mapbundle := range manifest.Maps {
+		info := MapInfo{
+			Name:     mapbundle.Name,
+			Title:    mapbundle.Title,
+			Comment:  mapbundle.Comment,
+			Url:      mapbundle.Url,
+			Source:   mapbundle.Source,
+			Checksum: mapbundle.getChecksum(),
+			Pinned:   pins[mapbundle.Name],
+		}
 
-		mapBundleLocation := GetMapLocation(mapbundle.Name)
 		mapChecksum, err := GetLocalMapChecksum(mapbundle)
 
-		downloaded := true
-		uptodate := true
-		if err != nil {
-			// Local map has never been downloaded
-			downloaded = false
-			uptodate = false
-			someMissing = true
+		// Otherwise the local map has never been downloaded
+		if err == nil {
+			location := GetMapLocation(mapbundle.Name)
+
+			info.Downloaded = true
+			info.Location = location
+			info.UpToDate = strings.EqualFold(mapChecksum, mapbundle.getChecksum())
+
+			if stat, err := os.Stat(location); err == nil {
+				info.Size = stat.Size()
+			}
+		}
+
+		maps = append(maps, info)
+	}
+
+	return maps, nil
+}
+
+func MapListAction(format string) error {
+	maps, err := GetMapList()
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case MAP_LIST_FORMAT_JSON:
+		data, _ := json.MarshalIndent(maps, "", "    ")
+		fmt.Println(string(data))
+
+	case MAP_LIST_FORMAT_TABLE:
+		printMapTable(maps)
+
+	case MAP_LIST_FORMAT_TEXT, "":
+		printMapList(maps)
+
+	default:
+		return bettererrors.
+			New("Unknown format; expected text, table or json").
+			SetContext("format", format)
+	}
+
+	return nil
+}
+
+func printMapTable(maps []MapInfo) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "NAME\tTITLE\tSTATUS\tSIZE\tCHECKSUM\tLOCATION")
+
+	for _, info := range maps {
+		status := "up to date"
+
+		switch {
+		case !info.Downloaded:
+			status = "missing"
+		case !info.UpToDate:
+			status = "outdated"
+		}
+
+		if info.Pinned != "" {
+			status += " (pinned)"
+		}
+
+		size := "-"
+		if info.Downloaded {
+			size = humanize.Size(info.Size)
 		}
 
-		if downloaded && (mapChecksum != mapbundle.Md5) {
-			uptodate = false
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", info.Name, info.Title, status, size, info.Checksum, info.Location)
+	}
+
+	w.Flush()
+}
+
+func printMapList(maps []MapInfo) {
+	someOutdated := false
+	someMissing := false
+
+	fmt.Printf("%d maps in manifest.\n", len(maps))
+	fmt.Println("")
+
+	for _, info := range maps {
+
+		if !info.Downloaded {
+			someMissing = true
+		} else if !info.UpToDate {
 			someOutdated = true
 		}
 
-		fmt.Println(fmt.Sprintf("# %s", mapbundle.Title))
-		fmt.Println(fmt.Sprintf("- Name    : %s (--map \"%s\")", mapbundle.Name, mapbundle.Name))
-		fmt.Println(fmt.Sprintf("- Info    : %s", mapbundle.Comment))
-		fmt.Println(fmt.Sprintf("- URL     : %s", mapbundle.Url))
-		if downloaded {
-			fmt.Println(fmt.Sprintf("- On disk : %s", mapBundleLocation))
+		fmt.Println(fmt.Sprintf("# %s", info.Title))
+		fmt.Println(fmt.Sprintf("- Name    : %s (--map \"%s\")", info.Name, info.Name))
+		fmt.Println(fmt.Sprintf("- Info    : %s", info.Comment))
+		fmt.Println(fmt.Sprintf("- URL     : %s", info.Url))
+		if info.Source != "" {
+			fmt.Println(fmt.Sprintf("- Source  : %s", info.Source))
+		}
+		if info.Downloaded {
+			fmt.Println(fmt.Sprintf("- On disk : %s", info.Location))
 		} else {
 			fmt.Println(fmt.Sprintf("- On disk : Never fetched"))
 		}
 
-		if !uptodate {
+		if info.Pinned != "" {
+			fmt.Println(fmt.Sprintf("- Pinned  : %s", info.Pinned))
+		}
+
+		if !info.UpToDate {
 			fmt.Println(fmt.Sprintf("- Status  : outdated"))
 		}
 
@@ -94,25 +215,97 @@ func MapListAction() {
 	}
 }
 
-func MapUpdateAction(debug func(str string)) {
+type MapUpdateActionArguments struct {
+	Debug           func(str string)
+	ManifestSources []string
+	PublicKeyFiles  []string
+	Jobs            int
+
+	// Maps to update; all of them if empty
+	Names []string
+
+	// Only report what would change
+	Check bool
+}
+
+// MapsOutdatedError is returned by MapUpdateAction with Check when maps are
+// to be downloaded; the maps were reported, only the exit code is left.
+type MapsOutdatedError struct {
+	ToDownload  int
+	Unavailable int
+}
+
+func (e MapsOutdatedError) Error() string {
+	return fmt.Sprintf("%d maps to download, %d pinned maps unavailable", e.ToDownload, e.Unavailable)
+}
+
+func MapUpdateAction(args MapUpdateActionArguments) error {
 
 	err := ensureMapDir()
 	if err != nil {
-		utils.FailWith(err)
+		return err
+	}
+
+	publicKeys, err := LoadManifestPublicKeys(args.PublicKeyFiles)
+	if err != nil {
+		return err
+	}
+
+	pins, err := getMapPins()
+	if err != nil {
+		return err
+	}
+
+	manifestSources := GetManifestSources(args.ManifestSources)
+
+	for _, source := range manifestSources {
+		fmt.Println("Downloading map manifest from " + source)
 	}
 
-	fmt.Println("Downloading map manifest from " + MANIFEST_URL)
 	fmt.Println("")
 
-	mapManifest, errManifest := FetchManifest(MANIFEST_URL)
+	mapManifest, errManifest := FetchManifests(manifestSources, publicKeys)
 	if errManifest != nil {
-		utils.FailWith(errManifest)
+		return errManifest
+	}
+
+	previousManifest, _ := getLocalMapManifest()
+	mapManifest = applyMapPins(mapManifest, previousManifest, pins)
+
+	selected, errSelect := selectMaps(mapManifest, args.Names)
+	if errSelect != nil {
+		return errSelect
+	}
+
+	if !args.Check {
+		errPersist := persistLocalMapManifest(mapManifest)
+		if errPersist != nil {
+			return errPersist
+		}
 	}
 
-	for _, mapbundle := range mapManifest.Maps {
+	toDownload := make([]mapBundleType, 0)
+	unavailable := 0
+
+	for _, mapbundle := range selected {
 
 		fmt.Println(fmt.Sprintf("# Map \"%s\" (%s)", mapbundle.Name, mapbundle.Url))
-		fmt.Println("")
+
+		if pin, ok := pins[mapbundle.Name]; ok {
+			fmt.Println(fmt.Sprintf("Map is pinned to %s.", pin))
+
+			if !mapbundle.matchesChecksum(pin) {
+				if localMapMatchesChecksum(mapbundle.Name, pin) {
+					fmt.Println("[OK] Keeping the pinned version; the manifest has another one.")
+				} else {
+					fmt.Println("[ERROR] The pinned version is neither on disk nor in the manifest.")
+					unavailable++
+				}
+
+				fmt.Println("")
+				continue
+			}
+		}
 
 		mapExistsLocally := true
 
@@ -123,187 +316,192 @@ func MapUpdateAction(debug func(str string)) {
 			mapExistsLocally = false
 		}
 
-		if !mapExistsLocally || mapChecksum != mapbundle.Md5 {
+		if !mapExistsLocally || !strings.EqualFold(mapChecksum, mapbundle.getChecksum()) {
 
 			if mapExistsLocally {
 				fmt.Println("Local version exists, but is outdated; downloading the new version.")
 			}
 
-			fmt.Println("")
-			err := DownloadMap(mapbundle)
-			fmt.Println("")
-
-			if err != nil {
-				utils.FailWith(err)
-			}
-
-			fmt.Println("[OK] Map downloaded!")
+			toDownload = append(toDownload, mapbundle)
 		} else {
 			fmt.Println("[OK] Map already up to date!")
 		}
 
 		fmt.Println("")
 	}
-}
 
-func GetMapLocation(mapname string) string {
-	mapsDir, err := utils.GetTrainerMapsDir()
+	if args.Check {
+		if len(toDownload) > 0 || unavailable > 0 {
+			err := MapsOutdatedError{ToDownload: len(toDownload), Unavailable: unavailable}
+			fmt.Println(err.Error() + ".")
 
-	if err != nil {
-		utils.FailWith(err)
-	}
+			return err
+		}
 
-	return path.Join(mapsDir, mapname+".zip")
-}
+		fmt.Println("[OK] All maps are up to date!")
+		return nil
+	}
 
-func GetLocalMapChecksum(bundle mapBundleType) (string, error) {
-	file, err := getMapLocally(bundle)
-	defer file.Close()
+	// The other maps are still downloaded
+	var errUnavailable error
 
-	if err != nil {
-		return "", err
+	if unavailable > 0 {
+		errUnavailable = bettererrors.
+			New("Some pinned maps are unavailable; unpin them to follow the manifest").
+			SetContext("unavailable", fmt.Sprintf("%d", unavailable))
 	}
 
-	h := md5.New()
-	if _, err := io.Copy(h, file); err != nil {
-		log.Fatal(err)
+	if len(toDownload) == 0 {
+		return errUnavailable
 	}
 
-	return hex.EncodeToString(h.Sum(nil)), nil
-}
+	args.Debug(fmt.Sprintf("Downloading %d maps, %d at a time", len(toDownload), args.Jobs))
 
-func DownloadMap(mapbundle mapBundleType) error {
+	errs := DownloadMaps(toDownload, args.Jobs)
+	fmt.Println("")
 
-	head, errHead := http.Head(mapbundle.Url)
-	head.Body.Close()
+	failed := 0
 
-	if errHead != nil {
-		return bettererrors.
-			New("Could not get map "+mapbundle.Name).
-			With(bettererrors.NewFromErr(errHead)).
-			SetContext("url", mapbundle.Url)
+	for i, mapbundle := range toDownload {
+		if errs[i] != nil {
+			failed++
+			fmt.Println(fmt.Sprintf("[ERROR] Map \"%s\" could not be downloaded: %s", mapbundle.Name, errs[i].Error()))
+		} else {
+			fmt.Println(fmt.Sprintf("[OK] Map \"%s\" downloaded!", mapbundle.Name))
+		}
 	}
 
-	if head.StatusCode != 200 {
-		msg := fmt.Sprintf("Could not get map %s from %s: server returned code %s", mapbundle.Name, mapbundle.Url, head.Status)
-		return bettererrors.New(msg)
-	}
+	if failed > 0 {
+		berror := bettererrors.
+			New("Some maps could not be downloaded; run the command again to resume").
+			SetContext("failed", fmt.Sprintf("%d", failed))
 
-	fileSize := int(head.ContentLength)
+		if errUnavailable != nil {
+			berror = berror.With(errUnavailable)
+		}
 
-	res, errGet := http.Get(mapbundle.Url)
-	if errGet != nil {
-		return bettererrors.
-			New("Could not get map "+mapbundle.Name).
-			With(errHead).
-			SetContext("url", mapbundle.Url)
+		return berror
 	}
 
-	tmpFile, tmpFileErr := ioutil.TempFile("", "bamap")
+	return errUnavailable
+}
 
-	if tmpFileErr != nil {
-		return bettererrors.
-			New("Could not open tmpfile").
-			With(tmpFileErr)
+// selectMaps returns the maps of the manifest with the given names, or all of
+// them if no name is given.
+func selectMaps(manifest manifestType, names []string) ([]mapBundleType, error) {
+	if len(names) == 0 {
+		return manifest.Maps, nil
 	}
 
-	bar := pb.New(fileSize)
-	bar.SetWidth(80)
-	bar.Start()
+	selected := make([]mapBundleType, 0)
 
-	rd := bar.NewProxyReader(res.Body)
-	_, tmpCopyErr := io.Copy(tmpFile, rd)
+	for _, name := range names {
+		found := false
 
-	if tmpCopyErr != nil {
-		return bettererrors.
-			New("Error during copy to tmp").
-			With(tmpCopyErr).
-			SetContext("filename", tmpFile.Name())
+		for _, mapbundle := range manifest.Maps {
+			if mapbundle.Name == name {
+				selected = append(selected, mapbundle)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, bettererrors.
+				New("Map is not in the manifest").
+				SetContext("map", name)
+		}
 	}
 
-	bar.Finish()
+	return selected, nil
+}
 
-	// Actually writing on disk the buffer
-	mapBundleDestinationPath := GetMapLocation(mapbundle.Name)
-	removeErr := os.Remove(mapBundleDestinationPath)
+func GetMapLocation(mapname string) string {
+	mapsDir, err := utils.GetTrainerMapsDir()
 
-	if removeErr != nil {
-		return bettererrors.
-			New("Could not delete mapbundle").
-			With(removeErr).
-			SetContext("name", mapbundle.Name).
-			SetContext("location", mapBundleDestinationPath)
+	if err != nil {
+		utils.FailWith(err)
 	}
 
-	file, errOpen := os.OpenFile(mapBundleDestinationPath, os.O_WRONLY|os.O_CREATE, 0755)
+	return path.Join(mapsDir, mapname+".zip")
+}
 
-	if errOpen != nil {
-		return bettererrors.
-			New("Could not open destination file for map").
-			With(errOpen).
-			SetContext("name", mapbundle.Name).
-			SetContext("location", mapBundleDestinationPath)
+// getChecksum returns the digest the local map pack is compared to, in the
+// strongest algorithm given by the manifest.
+func (bundle mapBundleType) getChecksum() string {
+	if bundle.Sha256 != "" {
+		return bundle.Sha256
 	}
 
-	tmpFile.Seek(0, 0)
-	_, copyErr := io.Copy(file, tmpFile)
-
-	if copyErr != nil {
-		return bettererrors.
-			New("Error during copy to tmp").
-			With(copyErr).
-			SetContext("filename", file.Name())
-	}
+	return bundle.Md5
+}
 
-	file.Close()
+// GetLocalMapChecksum returns the digest of the local map pack, in the
+// algorithm of getChecksum.
+func GetLocalMapChecksum(bundle mapBundleType) (string, error) {
+	bundleLocation := GetMapLocation(bundle.Name)
 
-	tmpFile.Close()
-	os.Remove(tmpFile.Name())
+	if bundle.Sha256 != "" {
+		return getFileSha256(bundleLocation)
+	}
 
-	return nil
+	return getFileMd5(bundleLocation)
 }
 
-func FetchManifest(manifesturl string) (manifestType, error) {
+// verifyMapFile checks a downloaded map pack against its manifest entry.
+func verifyMapFile(bundle mapBundleType, filename string) error {
+	var checksum string
+	var err error
 
-	var manifest manifestType
+	algorithm := "sha256"
 
-	res, err := http.Get(manifesturl)
+	switch {
+	case bundle.Sha256 != "":
+		checksum, err = getFileSha256(filename)
+	case bundle.Md5 != "":
+		algorithm = "md5"
+		checksum, err = getFileMd5(filename)
+	default:
+		return bettererrors.
+			New("Manifest gives no checksum for map "+bundle.Name).
+			SetContext("manifest", bundle.Source)
+	}
 
 	if err != nil {
-		return manifest, bettererrors.
-			New("Could not download manifest").
-			With(bettererrors.NewFromErr(err)).
-			SetContext("manifest url", MANIFEST_URL)
+		return err
 	}
 
-	defer res.Body.Close()
-
-	if res.StatusCode != 200 {
-		msg := fmt.Sprintf("Could not download manifest (%s): server returned code %s", MANIFEST_URL, res.Status)
-		return manifest, bettererrors.New(msg)
+	if !strings.EqualFold(checksum, bundle.getChecksum()) {
+		return bettererrors.
+			New("Checksum of map "+bundle.Name+" does not match the manifest").
+			SetContext("algorithm", algorithm).
+			SetContext("expected", bundle.getChecksum()).
+			SetContext("actual", checksum).
+			SetContext("url", bundle.Url)
 	}
 
-	data, _ := ioutil.ReadAll(res.Body)
-	err = json.Unmarshal(data, &manifest)
+	return nil
+}
 
+// persistLocalMapManifest keeps the merged manifest for `map list` and for
+// resolving maps by name.
+func persistLocalMapManifest(manifest manifestType) error {
+	manifestPath, err := utils.GetTrainerMapsManifestPath()
 	if err != nil {
-		return manifest, bettererrors.
-			New("Could not parse manifest").
-			With(bettererrors.NewFromErr(err)).
-			SetContext("manifest url", manifesturl)
+		return err
 	}
 
-	// Persist the manifest locally
-	manifestPath, err := utils.GetTrainerMapsManifestPath()
+	data, _ := json.MarshalIndent(manifest, "", "    ")
+
 	err = ioutil.WriteFile(manifestPath, data, 0644)
 	if err != nil {
-		return manifest, bettererrors.
+		return bettererrors.
 			New("Could not persist the manifest locally").
 			With(bettererrors.NewFromErr(err)).
 			SetContext("manifest path", manifestPath)
 	}
 
-	return manifest, nil
+	return nil
 }
 
 func getLocalMapManifest() (manifestType, error) {
@@ -331,21 +529,6 @@ func getLocalMapManifest() (manifestType, error) {
 	return manifest, nil
 }
 
-func getMapLocally(bundle mapBundleType) (*os.File, error) {
-
-	bundleLocation := GetMapLocation(bundle.Name)
-	f, err := os.OpenFile(bundleLocation, os.O_RDONLY, 0755)
-
-	if err != nil {
-		return nil, bettererrors.
-			New("Could not open map file").
-			With(bettererrors.NewFromErr(err)).
-			SetContext("map file", bundleLocation)
-	}
-
-	return f, nil
-}
-
 func ensureMapDir() error {
 
 	mapsDir, err := utils.GetTrainerMapsDir()
@@ -0,0 +1,326 @@
+package mapcmd
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	bettererrors "github.com/xtuc/better-errors"
+)
+
+// GetManifestSources returns the manifests to fetch the maps from, the
+// official one being used when none is given.
+func GetManifestSources(sources []string) []string {
+	res := make([]string, 0)
+
+	for _, source := range sources {
+		if source = strings.TrimSpace(source); source != "" {
+			res = append(res, source)
+		}
+	}
+
+	if len(res) == 0 {
+		return []string{MANIFEST_URL}
+	}
+
+	return res
+}
+
+// FetchManifests fetches and merges the given manifests. When a map is listed
+// in several of them, the first source listing it wins.
+func FetchManifests(sources []string, publicKeys []crypto.PublicKey) (manifestType, error) {
+	var merged manifestType
+
+	seen := make(map[string]string)
+
+	for _, source := range sources {
+		manifest, err := FetchManifest(source, publicKeys)
+		if err != nil {
+			return merged, err
+		}
+
+		for _, mapbundle := range manifest.Maps {
+			if from, ok := seen[mapbundle.Name]; ok {
+				if from != source {
+					fmt.Printf("Map \"%s\" of %s is ignored; already provided by %s\n", mapbundle.Name, source, from)
+				}
+
+				continue
+			}
+
+			seen[mapbundle.Name] = source
+			merged.Maps = append(merged.Maps, mapbundle)
+		}
+	}
+
+	return merged, nil
+}
+
+// FetchManifest fetches a manifest from an URL, a file:// URL or a local
+// path. The maps of the manifest are annotated with their source, and their
+// URLs resolved relatively to it. When public keys are given, the manifest
+// must come with a detached signature made with one of them.
+func FetchManifest(source string, publicKeys []crypto.PublicKey) (manifestType, error) {
+	var manifest manifestType
+
+	reader, _, err := openSource(source)
+	if err != nil {
+		return manifest, bettererrors.
+			New("Could not download manifest").
+			With(err).
+			SetContext("manifest", source)
+	}
+
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return manifest, bettererrors.
+			New("Could not download manifest").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("manifest", source)
+	}
+
+	if len(publicKeys) > 0 {
+		if err := verifyManifest(source, data, publicKeys); err != nil {
+			return manifest, err
+		}
+	}
+
+	err = json.Unmarshal(data, &manifest)
+
+	if err != nil {
+		return manifest, bettererrors.
+			New("Could not parse manifest").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("manifest", source)
+	}
+
+	for i := range manifest.Maps {
+		manifest.Maps[i].Source = source
+		manifest.Maps[i].Url = resolveSourceUrl(source, manifest.Maps[i].Url)
+	}
+
+	return manifest, nil
+}
+
+func verifyManifest(source string, data []byte, publicKeys []crypto.PublicKey) error {
+	signatureSource := source + MANIFEST_SIGNATURE_SUFFIX
+
+	reader, _, err := openSource(signatureSource)
+	if err != nil {
+		return bettererrors.
+			New("Could not download manifest signature").
+			With(err).
+			SetContext("signature", signatureSource)
+	}
+
+	defer reader.Close()
+
+	signature, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return bettererrors.
+			New("Could not download manifest signature").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("signature", signatureSource)
+	}
+
+	if err := verifyManifestSignature(data, signature, publicKeys); err != nil {
+		return bettererrors.
+			New("Could not verify manifest").
+			With(err).
+			SetContext("manifest", source)
+	}
+
+	return nil
+}
+
+func isRemoteSource(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+func getSourcePath(source string) string {
+	return filepath.FromSlash(strings.TrimPrefix(source, "file://"))
+}
+
+// resolveSourceUrl resolves the URL of a map relatively to the manifest
+// listing it, so that a manifest can sit next to its map packs.
+func resolveSourceUrl(source, mapurl string) string {
+	if isRemoteSource(mapurl) || strings.HasPrefix(mapurl, "file://") {
+		return mapurl
+	}
+
+	if isRemoteSource(source) {
+		base, err := url.Parse(source)
+		if err != nil {
+			return mapurl
+		}
+
+		ref, err := url.Parse(mapurl)
+		if err != nil {
+			return mapurl
+		}
+
+		return base.ResolveReference(ref).String()
+	}
+
+	if filepath.IsAbs(mapurl) {
+		return mapurl
+	}
+
+	return filepath.Join(filepath.Dir(getSourcePath(source)), filepath.FromSlash(mapurl))
+}
+
+// openSource opens an URL, a file:// URL or a local path for reading, and
+// returns its size when known (-1 otherwise).
+func openSource(source string) (io.ReadCloser, int64, error) {
+	reader, size, _, err := openSourceAt(source, 0)
+	return reader, size, err
+}
+
+// openSourceAt opens a source for reading from offset, using a ranged request
+// for URLs. Servers may ignore the range, so the offset the reader actually
+// starts at is returned along with the full size of the source.
+func openSourceAt(source string, offset int64) (io.ReadCloser, int64, int64, error) {
+	if !isRemoteSource(source) {
+		filename := getSourcePath(source)
+
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, -1, 0, bettererrors.NewFromErr(err)
+		}
+
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, -1, 0, bettererrors.NewFromErr(err)
+		}
+
+		if offset > info.Size() {
+			offset = 0
+		}
+
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, -1, 0, bettererrors.NewFromErr(err)
+		}
+
+		return file, info.Size(), offset, nil
+	}
+
+	req, err := http.NewRequest("GET", source, nil)
+	if err != nil {
+		return nil, -1, 0, bettererrors.NewFromErr(err)
+	}
+
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, -1, 0, bettererrors.NewFromErr(err)
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return res.Body, res.ContentLength, 0, nil
+
+	case http.StatusPartialContent:
+		start, total, err := parseContentRange(res.Header.Get("Content-Range"))
+
+		// Appending anything else than what follows would corrupt the file
+		if err != nil || start != offset {
+			res.Body.Close()
+			return openSourceAt(source, 0)
+		}
+
+		if total < 0 && res.ContentLength >= 0 {
+			total = offset + res.ContentLength
+		}
+
+		return res.Body, total, offset, nil
+
+	case http.StatusRequestedRangeNotSatisfiable:
+		res.Body.Close()
+
+		// Nothing follows the offset when the file is already complete;
+		// what it holds is then verified like any download
+		if _, total, err := parseContentRange(res.Header.Get("Content-Range")); err == nil && total == offset {
+			return ioutil.NopCloser(bytes.NewReader(nil)), total, offset, nil
+		}
+
+		return openSourceAt(source, 0)
+	}
+
+	res.Body.Close()
+
+	return nil, -1, 0, bettererrors.
+		New("Server returned code "+res.Status).
+		SetContext("url", source)
+}
+
+// parseContentRange returns the first byte and the full size given by a
+// Content-Range header, "bytes first-last/size" for partial content or
+// "bytes */size" for unsatisfiable ranges. Unknown values are -1.
+func parseContentRange(value string) (int64, int64, error) {
+	invalid := bettererrors.
+		New("Invalid Content-Range header").
+		SetContext("value", value)
+
+	if !strings.HasPrefix(value, "bytes ") {
+		return -1, -1, invalid
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(value, "bytes "), "/", 2)
+	if len(parts) != 2 {
+		return -1, -1, invalid
+	}
+
+	start := int64(-1)
+
+	if parts[0] != "*" {
+		bounds := strings.SplitN(parts[0], "-", 2)
+		if len(bounds) != 2 {
+			return -1, -1, invalid
+		}
+
+		first, err := strconv.ParseInt(bounds[0], 10, 64)
+		if err != nil {
+			return -1, -1, invalid
+		}
+
+		last, err := strconv.ParseInt(bounds[1], 10, 64)
+		if err != nil || last < first {
+			return -1, -1, invalid
+		}
+
+		start = first
+	}
+
+	total := int64(-1)
+
+	if parts[1] != "*" {
+		size, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return -1, -1, invalid
+		}
+
+		total = size
+	}
+
+	if start < 0 && total < 0 {
+		return -1, -1, invalid
+	}
+
+	return start, total, nil
+}
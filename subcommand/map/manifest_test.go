@@ -0,0 +1,106 @@
+package mapcmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		value         string
+		start         int64
+		total         int64
+		expectedError bool
+	}{
+		{value: "bytes 100-199/200", start: 100, total: 200},
+		{value: "bytes 0-99/*", start: 0, total: -1},
+		{value: "bytes */200", start: -1, total: 200},
+		{value: "bytes */*", expectedError: true},
+		{value: "bytes 100-/200", expectedError: true},
+		{value: "bytes 199-100/200", expectedError: true},
+		{value: "items 0-1/2", expectedError: true},
+		{value: "", expectedError: true},
+	}
+
+	for _, test := range tests {
+		start, total, err := parseContentRange(test.value)
+
+		if test.expectedError {
+			if err == nil {
+				t.Errorf("%q: expected an error", test.value)
+			}
+
+			continue
+		}
+
+		if err != nil || start != test.start || total != test.total {
+			t.Errorf("%q: expected %d and %d, got %d and %d (%v)", test.value, test.start, test.total, start, total, err)
+		}
+	}
+}
+
+// rangeServer serves content, answering ranged requests with the given
+// Content-Range, or a range of its own when it is empty.
+func rangeServer(content string, status int, contentRange string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "" {
+			fmt.Fprint(w, content)
+			return
+		}
+
+		var offset int
+		fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &offset)
+
+		if contentRange == "" {
+			contentRange = fmt.Sprintf("bytes %d-%d/%d", offset, len(content)-1, len(content))
+		}
+
+		w.Header().Set("Content-Range", contentRange)
+		w.WriteHeader(status)
+
+		if status == http.StatusPartialContent && offset < len(content) {
+			fmt.Fprint(w, content[offset:])
+		}
+	}))
+}
+
+func TestOpenSourceAt(t *testing.T) {
+	content := "0123456789"
+
+	tests := []struct {
+		name         string
+		status       int
+		contentRange string
+		offset       int64
+		start        int64
+		body         string
+	}{
+		{name: "resumed", status: http.StatusPartialContent, offset: 4, start: 4, body: "456789"},
+		{name: "other range", status: http.StatusPartialContent, contentRange: "bytes 2-9/10", offset: 4, start: 0, body: content},
+		{name: "complete", status: http.StatusRequestedRangeNotSatisfiable, contentRange: "bytes */10", offset: 10, start: 10, body: ""},
+		{name: "larger", status: http.StatusRequestedRangeNotSatisfiable, contentRange: "bytes */10", offset: 12, start: 0, body: content},
+	}
+
+	for _, test := range tests {
+		server := rangeServer(content, test.status, test.contentRange)
+
+		body, size, start, err := openSourceAt(server.URL, test.offset)
+
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			server.Close()
+			continue
+		}
+
+		data, _ := ioutil.ReadAll(body)
+		body.Close()
+		server.Close()
+
+		if start != test.start || string(data) != test.body || size != int64(len(content)) {
+			t.Errorf("%s: expected %q from %d of %d, got %q from %d of %d", test.name, test.body, test.start, len(content), string(data), start, size)
+		}
+	}
+}
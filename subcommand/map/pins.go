@@ -0,0 +1,195 @@
+package mapcmd
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	bettererrors "github.com/xtuc/better-errors"
+
+	"github.com/bytearena/core/common/utils"
+)
+
+const (
+	// Checksum each pinned map is held at by `map update`
+	MAP_PINS_FILENAME = "pins.json"
+)
+
+type mapPinsType map[string]string
+
+func getMapPinsPath() (string, error) {
+	mapsDir, err := utils.GetTrainerMapsDir()
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(mapsDir, MAP_PINS_FILENAME), nil
+}
+
+func getMapPins() (mapPinsType, error) {
+	pins := make(mapPinsType)
+
+	pinsPath, err := getMapPinsPath()
+	if err != nil {
+		return pins, err
+	}
+
+	data, err := ioutil.ReadFile(pinsPath)
+	if err != nil {
+		// No map has been pinned yet
+		return pins, nil
+	}
+
+	err = json.Unmarshal(data, &pins)
+	if err != nil {
+		return pins, bettererrors.
+			New("Could not parse map pins").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("location", pinsPath)
+	}
+
+	return pins, nil
+}
+
+func persistMapPins(pins mapPinsType) error {
+	pinsPath, err := getMapPinsPath()
+	if err != nil {
+		return err
+	}
+
+	data, _ := json.MarshalIndent(pins, "", "    ")
+
+	err = ioutil.WriteFile(pinsPath, data, 0644)
+	if err != nil {
+		return bettererrors.
+			New("Could not persist map pins").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("location", pinsPath)
+	}
+
+	return nil
+}
+
+// matchesChecksum tells whether a checksum, either SHA-256 or MD5, is the one
+// of the map in the manifest.
+func (bundle mapBundleType) matchesChecksum(checksum string) bool {
+	return (bundle.Sha256 != "" && strings.EqualFold(bundle.Sha256, checksum)) ||
+		(bundle.Md5 != "" && strings.EqualFold(bundle.Md5, checksum))
+}
+
+// localMapMatchesChecksum compares the local map pack to a checksum, either
+// SHA-256 or MD5.
+func localMapMatchesChecksum(mapname, checksum string) bool {
+	var local string
+	var err error
+
+	if len(checksum) == hex.EncodedLen(32) {
+		local, err = getFileSha256(GetMapLocation(mapname))
+	} else {
+		local, err = getFileMd5(GetMapLocation(mapname))
+	}
+
+	return err == nil && strings.EqualFold(local, checksum)
+}
+
+func isChecksum(value string) bool {
+	if len(value) != hex.EncodedLen(32) && len(value) != hex.EncodedLen(16) {
+		return false
+	}
+
+	_, err := hex.DecodeString(value)
+
+	return err == nil
+}
+
+// MapPinAction holds a map at a checksum, by default the one of the map on
+// disk, so that manifest changes don't alter it.
+func MapPinAction(mapname, checksum string) error {
+	if mapname == "" {
+		return bettererrors.New("No map was specified")
+	}
+
+	if checksum == "" {
+		local, err := getFileSha256(GetMapLocation(mapname))
+		if err != nil {
+			return bettererrors.
+				New("Map is not in the local cache; specify the checksum to pin it to").
+				With(err).
+				SetContext("map", mapname)
+		}
+
+		checksum = local
+	}
+
+	if !isChecksum(checksum) {
+		return bettererrors.
+			New("Invalid checksum; expected a SHA-256 or MD5 digest").
+			SetContext("checksum", checksum)
+	}
+
+	pins, err := getMapPins()
+	if err != nil {
+		return err
+	}
+
+	pins[mapname] = strings.ToLower(checksum)
+
+	if err := persistMapPins(pins); err != nil {
+		return err
+	}
+
+	fmt.Printf("[OK] Map %s pinned to %s\n", mapname, pins[mapname])
+
+	return nil
+}
+
+func MapUnpinAction(mapname string) error {
+	if mapname == "" {
+		return bettererrors.New("No map was specified")
+	}
+
+	pins, err := getMapPins()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := pins[mapname]; !ok {
+		return bettererrors.
+			New("Map is not pinned").
+			SetContext("map", mapname)
+	}
+
+	delete(pins, mapname)
+
+	if err := persistMapPins(pins); err != nil {
+		return err
+	}
+
+	fmt.Printf("[OK] Map %s unpinned\n", mapname)
+
+	return nil
+}
+
+// applyMapPins keeps the previous manifest entries of the pinned maps the new
+// manifest has another version of, so that they still verify.
+func applyMapPins(manifest manifestType, previous manifestType, pins mapPinsType) manifestType {
+	for i, mapbundle := range manifest.Maps {
+		pin, ok := pins[mapbundle.Name]
+
+		if !ok || mapbundle.matchesChecksum(pin) {
+			continue
+		}
+
+		for _, old := range previous.Maps {
+			if old.Name == mapbundle.Name && old.matchesChecksum(pin) {
+				manifest.Maps[i] = old
+				break
+			}
+		}
+	}
+
+	return manifest
+}
@@ -0,0 +1,98 @@
+package mapcmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+const (
+	testSha256    = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	testOldSha256 = "60303ae22b998861bce3b28f33eec1be758a213c86c93c076dbe9f558c11c752"
+	testMd5       = "098f6bcd4621d373cade4e832627b4f6"
+)
+
+func TestMatchesChecksum(t *testing.T) {
+	tests := []struct {
+		bundle   mapBundleType
+		checksum string
+		expected bool
+	}{
+		{bundle: mapBundleType{Sha256: testSha256, Md5: testMd5}, checksum: testSha256, expected: true},
+		{bundle: mapBundleType{Sha256: testSha256, Md5: testMd5}, checksum: testMd5, expected: true},
+		{bundle: mapBundleType{Md5: testMd5}, checksum: "098F6BCD4621D373CADE4E832627B4F6", expected: true},
+		{bundle: mapBundleType{Sha256: testSha256}, checksum: testOldSha256, expected: false},
+		{bundle: mapBundleType{}, checksum: "", expected: false},
+	}
+
+	for _, test := range tests {
+		if actual := test.bundle.matchesChecksum(test.checksum); actual != test.expected {
+			t.Errorf("%+v with %q: expected %v, got %v", test.bundle, test.checksum, test.expected, actual)
+		}
+	}
+}
+
+func TestIsChecksum(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected bool
+	}{
+		{value: testSha256, expected: true},
+		{value: testMd5, expected: true},
+		{value: testMd5[:31], expected: false},
+		{value: "zz8f6bcd4621d373cade4e832627b4f6", expected: false},
+		{value: "", expected: false},
+	}
+
+	for _, test := range tests {
+		if actual := isChecksum(test.value); actual != test.expected {
+			t.Errorf("%q: expected %v, got %v", test.value, test.expected, actual)
+		}
+	}
+}
+
+func TestApplyMapPins(t *testing.T) {
+	current := mapBundleType{Name: "hexagon", Sha256: testSha256, Url: "hexagon-2.zip"}
+	old := mapBundleType{Name: "hexagon", Sha256: testOldSha256, Url: "hexagon-1.zip"}
+	other := mapBundleType{Name: "desert", Md5: testMd5, Url: "desert.zip"}
+
+	tests := []struct {
+		name     string
+		previous []mapBundleType
+		pins     mapPinsType
+		expected []mapBundleType
+	}{
+		{
+			name:     "not pinned",
+			previous: []mapBundleType{old, other},
+			pins:     mapPinsType{},
+			expected: []mapBundleType{current, other},
+		},
+		{
+			name:     "pinned to the manifest version",
+			previous: []mapBundleType{old, other},
+			pins:     mapPinsType{"hexagon": testSha256},
+			expected: []mapBundleType{current, other},
+		},
+		{
+			name:     "pinned to the previous version",
+			previous: []mapBundleType{old, other},
+			pins:     mapPinsType{"hexagon": testOldSha256},
+			expected: []mapBundleType{old, other},
+		},
+		{
+			name:     "pinned version unknown",
+			previous: []mapBundleType{other},
+			pins:     mapPinsType{"hexagon": testOldSha256},
+			expected: []mapBundleType{current, other},
+		},
+	}
+
+	for _, test := range tests {
+		manifest := manifestType{Maps: []mapBundleType{current, other}}
+		actual := applyMapPins(manifest, manifestType{Maps: test.previous}, test.pins)
+
+		if !reflect.DeepEqual(actual.Maps, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, actual.Maps)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package mapcmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strings"
+
+	bettererrors "github.com/xtuc/better-errors"
+
+	"github.com/bytearena/core/common/mappack"
+	"github.com/bytearena/core/common/types/mapcontainer"
+)
+
+const (
+	MAP_PREVIEW_DEFAULT_WIDTH = 60
+
+	// Terminal characters are about twice as high as they are wide
+	MAP_PREVIEW_CHAR_RATIO = 0.5
+
+	MAP_PREVIEW_GROUND   = '.'
+	MAP_PREVIEW_BOUNDARY = '+'
+	MAP_PREVIEW_OBSTACLE = '#'
+)
+
+type MapShowActionArguments struct {
+	MapName string
+	Width   int
+	SvgFile string
+}
+
+type mapBounds struct {
+	MinX, MinY, MaxX, MaxY float64
+}
+
+func (b mapBounds) Width() float64  { return b.MaxX - b.MinX }
+func (b mapBounds) Height() float64 { return b.MaxY - b.MinY }
+
+// MapShowAction prints the stats and an ASCII preview of a map, and
+// optionally renders it as SVG.
+func MapShowAction(args MapShowActionArguments) error {
+	if args.MapName == "" {
+		return bettererrors.New("No map was specified")
+	}
+
+	if args.Width <= 0 {
+		args.Width = MAP_PREVIEW_DEFAULT_WIDTH
+	}
+
+	mapContainer, err := loadMapContainer(args.MapName)
+	if err != nil {
+		return err
+	}
+
+	bounds, ok := getBounds(mapContainer)
+	if !ok {
+		return bettererrors.
+			New("Map has no geometry to show").
+			SetContext("map", args.MapName)
+	}
+
+	printMapStats(args.MapName, mapContainer, bounds)
+	fmt.Println("")
+	fmt.Println(renderMapAscii(mapContainer, bounds, args.Width))
+
+	if args.SvgFile != "" {
+		svg := renderMapSvg(mapContainer, bounds)
+
+		if err := ioutil.WriteFile(args.SvgFile, []byte(svg), 0644); err != nil {
+			return bettererrors.
+				New("Could not write SVG file").
+				With(bettererrors.NewFromErr(err)).
+				SetContext("location", args.SvgFile)
+		}
+
+		fmt.Printf("[OK] Map rendered in %s\n", args.SvgFile)
+	}
+
+	return nil
+}
+
+func loadMapContainer(mapname string) (*mapcontainer.MapContainer, error) {
+	location, release, err := ResolveMapLocation(mapname)
+	if err != nil {
+		return nil, err
+	}
+
+	defer release()
+
+	bundle, err := mappack.UnzipAndGetHandles(location)
+	if err != nil {
+		return nil, bettererrors.
+			New("Could not open map pack").
+			With(err).
+			SetContext("location", location)
+	}
+
+	jsonsource, err := bundle.Open(MAP_JSON_FILENAME)
+	if err != nil {
+		return nil, bettererrors.
+			New("Map pack has no map.json").
+			With(err).
+			SetContext("location", location)
+	}
+
+	var mapContainer mapcontainer.MapContainer
+
+	if err := json.Unmarshal(jsonsource, &mapContainer); err != nil {
+		return nil, bettererrors.
+			New("Invalid map.json; check it with `ba map validate`").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("location", location)
+	}
+
+	return &mapContainer, nil
+}
+
+// getBounds returns the bounding box of the grounds, or of everything else
+// when the map has no ground.
+func getBounds(mapContainer *mapcontainer.MapContainer) (mapBounds, bool) {
+	points := make([]mapcontainer.MapPoint, 0)
+
+	for _, ground := range mapContainer.Data.Grounds {
+		for _, polygon := range ground.Outline {
+			points = append(points, polygon.Points...)
+		}
+	}
+
+	if len(points) == 0 {
+		for _, obstacle := range mapContainer.Data.Obstacles {
+			points = append(points, obstacle.Polygon.Points...)
+		}
+
+		for _, start := range mapContainer.Data.Starts {
+			points = append(points, start.Point)
+		}
+	}
+
+	if len(points) == 0 {
+		return mapBounds{}, false
+	}
+
+	bounds := mapBounds{
+		MinX: math.Inf(1), MinY: math.Inf(1),
+		MaxX: math.Inf(-1), MaxY: math.Inf(-1),
+	}
+
+	for _, point := range points {
+		bounds.MinX = math.Min(bounds.MinX, point[0])
+		bounds.MinY = math.Min(bounds.MinY, point[1])
+		bounds.MaxX = math.Max(bounds.MaxX, point[0])
+		bounds.MaxY = math.Max(bounds.MaxY, point[1])
+	}
+
+	return bounds, true
+}
+
+func printMapStats(mapname string, mapContainer *mapcontainer.MapContainer, bounds mapBounds) {
+	groundArea := 0.0
+	for _, ground := range mapContainer.Data.Grounds {
+		for _, polygon := range ground.Outline {
+			groundArea += polygonArea(polygon.Points)
+		}
+	}
+
+	obstacleArea := 0.0
+	for _, obstacle := range mapContainer.Data.Obstacles {
+		obstacleArea += polygonArea(obstacle.Polygon.Points)
+	}
+
+	fmt.Println(fmt.Sprintf("# %s", mapname))
+	fmt.Println(fmt.Sprintf("- Kind            : %s", mapContainer.Meta.Kind))
+	fmt.Println(fmt.Sprintf("- Max contestants : %d", mapContainer.Meta.MaxContestants))
+	fmt.Println(fmt.Sprintf("- Size            : %g x %g", bounds.Width(), bounds.Height()))
+	fmt.Println(fmt.Sprintf("- Ground area     : %.1f", groundArea))
+	fmt.Println(fmt.Sprintf("- Obstacles       : %d (area %.1f)", len(mapContainer.Data.Obstacles), obstacleArea))
+	fmt.Println(fmt.Sprintf("- Starts          : %d", len(mapContainer.Data.Starts)))
+}
+
+// renderMapAscii samples the map at the center of each character; starting
+// positions are numbered from 1 (then a, b, ...).
+func renderMapAscii(mapContainer *mapcontainer.MapContainer, bounds mapBounds, width int) string {
+	cellSize := bounds.Width() / float64(width)
+	if cellSize <= 0 {
+		cellSize = 1
+	}
+
+	height := int(math.Ceil(bounds.Height() / (cellSize / MAP_PREVIEW_CHAR_RATIO)))
+	if height < 1 {
+		height = 1
+	}
+
+	cellHeight := bounds.Height() / float64(height)
+	if cellHeight <= 0 {
+		cellHeight = cellSize / MAP_PREVIEW_CHAR_RATIO
+	}
+
+	onGround := func(point mapcontainer.MapPoint) bool {
+		for _, ground := range mapContainer.Data.Grounds {
+			for _, polygon := range ground.Outline {
+				if isPointInPolygon(point, polygon.Points) {
+					return true
+				}
+			}
+		}
+
+		return false
+	}
+
+	ground := make([][]bool, height)
+	grid := make([][]rune, height)
+
+	for y := 0; y < height; y++ {
+		ground[y] = make([]bool, width)
+		grid[y] = make([]rune, width)
+
+		for x := 0; x < width; x++ {
+			point := mapcontainer.MapPoint{
+				bounds.MinX + (float64(x)+0.5)*cellSize,
+				bounds.MinY + (float64(y)+0.5)*cellHeight,
+			}
+
+			ground[y][x] = onGround(point)
+			grid[y][x] = ' '
+
+			for _, obstacle := range mapContainer.Data.Obstacles {
+				if isPointInPolygon(point, obstacle.Polygon.Points) {
+					grid[y][x] = MAP_PREVIEW_OBSTACLE
+					break
+				}
+			}
+		}
+	}
+
+	isGround := func(x, y int) bool {
+		return x >= 0 && y >= 0 && x < width && y < height && ground[y][x]
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if !ground[y][x] || grid[y][x] != ' ' {
+				continue
+			}
+
+			if isGround(x-1, y) && isGround(x+1, y) && isGround(x, y-1) && isGround(x, y+1) {
+				grid[y][x] = MAP_PREVIEW_GROUND
+			} else {
+				grid[y][x] = MAP_PREVIEW_BOUNDARY
+			}
+		}
+	}
+
+	labels := "123456789abcdefghijklmnopqrstuvwxyz"
+
+	for i, start := range mapContainer.Data.Starts {
+		x := int((start.Point[0] - bounds.MinX) / cellSize)
+		y := int((start.Point[1] - bounds.MinY) / cellHeight)
+
+		if x < 0 || y < 0 || x >= width || y >= height {
+			continue
+		}
+
+		label := 'S'
+		if i < len(labels) {
+			label = rune(labels[i])
+		}
+
+		grid[y][x] = label
+	}
+
+	lines := make([]string, height)
+	for y := range grid {
+		lines[y] = strings.TrimRight(string(grid[y]), " ")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func renderMapSvg(mapContainer *mapcontainer.MapContainer, bounds mapBounds) string {
+	size := math.Max(bounds.Width(), bounds.Height())
+	margin := size * 0.05
+	radius := size * 0.01
+
+	polygonPoints := func(points []mapcontainer.MapPoint) string {
+		res := make([]string, len(points))
+
+		for i, point := range points {
+			res[i] = fmt.Sprintf("%g,%g", point[0], point[1])
+		}
+
+		return strings.Join(res, " ")
+	}
+
+	var svg bytes.Buffer
+
+	fmt.Fprintf(
+		&svg,
+		"<svg xmlns=\"http://www.w3.org/2000/svg\" viewBox=\"%g %g %g %g\">\n",
+		bounds.MinX-margin, bounds.MinY-margin, bounds.Width()+2*margin, bounds.Height()+2*margin,
+	)
+
+	for _, ground := range mapContainer.Data.Grounds {
+		for _, polygon := range ground.Outline {
+			fmt.Fprintf(&svg, "  <polygon points=\"%s\" fill=\"#e8e8e8\" stroke=\"#333333\" stroke-width=\"%g\"/>\n", polygonPoints(polygon.Points), radius/2)
+		}
+	}
+
+	for _, obstacle := range mapContainer.Data.Obstacles {
+		fmt.Fprintf(&svg, "  <polygon points=\"%s\" fill=\"#555555\"/>\n", polygonPoints(obstacle.Polygon.Points))
+	}
+
+	for i, start := range mapContainer.Data.Starts {
+		fmt.Fprintf(&svg, "  <circle cx=\"%g\" cy=\"%g\" r=\"%g\" fill=\"#d33c3c\"/>\n", start.Point[0], start.Point[1], radius)
+		fmt.Fprintf(&svg, "  <text x=\"%g\" y=\"%g\" font-size=\"%.3g\">%d</text>\n", start.Point[0]+radius*1.5, start.Point[1]-radius*1.5, radius*3, i+1)
+	}
+
+	svg.WriteString("</svg>\n")
+
+	return svg.String()
+}
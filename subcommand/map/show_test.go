@@ -0,0 +1,62 @@
+package mapcmd
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bytearena/core/common/types/mapcontainer"
+)
+
+func testMapContainer(t *testing.T) *mapcontainer.MapContainer {
+	var mapContainer mapcontainer.MapContainer
+
+	source := testMapJSON("", TEST_GROUND, TEST_STARTS, `{"id": "rock", "name": "Rock", "polygon": {"points": [[4, 4], [6, 4], [6, 6], [4, 6]]}}`)
+
+	if err := json.Unmarshal([]byte(source), &mapContainer); err != nil {
+		t.Fatal(err)
+	}
+
+	return &mapContainer
+}
+
+func TestRenderMapAscii(t *testing.T) {
+	mapContainer := testMapContainer(t)
+
+	bounds, ok := getBounds(mapContainer)
+	if !ok {
+		t.Fatal("expected the map to have bounds")
+	}
+
+	expected := "++++++++++\n" +
+		"+.1......+\n" +
+		"+...##...+\n" +
+		"+........+\n" +
+		"++++++++2+"
+
+	if actual := renderMapAscii(mapContainer, bounds, 10); actual != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, actual)
+	}
+}
+
+func TestRenderMapSvg(t *testing.T) {
+	mapContainer := testMapContainer(t)
+
+	bounds, ok := getBounds(mapContainer)
+	if !ok {
+		t.Fatal("expected the map to have bounds")
+	}
+
+	expected := `<svg xmlns="http://www.w3.org/2000/svg" viewBox="-0.5 -0.5 11 11">
+  <polygon points="0,0 10,0 10,10 0,10" fill="#e8e8e8" stroke="#333333" stroke-width="0.05"/>
+  <polygon points="4,4 6,4 6,6 4,6" fill="#555555"/>
+  <circle cx="2" cy="2" r="0.1" fill="#d33c3c"/>
+  <text x="2.15" y="1.85" font-size="0.3">1</text>
+  <circle cx="8" cy="8" r="0.1" fill="#d33c3c"/>
+  <text x="8.15" y="7.85" font-size="0.3">2</text>
+</svg>
+`
+
+	if actual := renderMapSvg(mapContainer, bounds); actual != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, actual)
+	}
+}
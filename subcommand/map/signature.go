@@ -0,0 +1,110 @@
+package mapcmd
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+
+	bettererrors "github.com/xtuc/better-errors"
+)
+
+const (
+	// The detached signature of a manifest is served next to it
+	MANIFEST_SIGNATURE_SUFFIX = ".sig"
+)
+
+// LoadManifestPublicKeys reads the PEM encoded (PKIX) RSA or ECDSA public keys
+// the manifests must be signed with.
+func LoadManifestPublicKeys(filenames []string) ([]crypto.PublicKey, error) {
+	keys := make([]crypto.PublicKey, 0)
+
+	for _, filename := range filenames {
+		data, err := ioutil.ReadFile(filename)
+
+		if err != nil {
+			return nil, bettererrors.
+				New("Could not read manifest public key").
+				With(bettererrors.NewFromErr(err)).
+				SetContext("file", filename)
+		}
+
+		block, _ := pem.Decode(data)
+
+		if block == nil {
+			return nil, bettererrors.
+				New("Manifest public key is not PEM encoded").
+				SetContext("file", filename)
+		}
+
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+
+		if err != nil {
+			return nil, bettererrors.
+				New("Could not parse manifest public key").
+				With(bettererrors.NewFromErr(err)).
+				SetContext("file", filename)
+		}
+
+		switch key.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey:
+			keys = append(keys, key)
+		default:
+			return nil, bettererrors.
+				New("Unsupported manifest public key; expected RSA or ECDSA").
+				SetContext("file", filename)
+		}
+	}
+
+	return keys, nil
+}
+
+// verifyManifestSignature checks the SHA-256 signature of a manifest, as
+// produced by `openssl dgst -sha256 -sign`, against any of the keys. The
+// signature may be raw or base64 encoded.
+func verifyManifestSignature(data, signature []byte, keys []crypto.PublicKey) error {
+	digest := sha256.Sum256(data)
+
+	candidates := [][]byte{signature}
+
+	if decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(signature))); err == nil {
+		candidates = append(candidates, decoded)
+	}
+
+	for _, key := range keys {
+		for _, sig := range candidates {
+			if verifySignature(key, digest[:], sig) {
+				return nil
+			}
+		}
+	}
+
+	return bettererrors.New("Manifest signature does not match any of the trusted public keys")
+}
+
+func verifySignature(key crypto.PublicKey, digest, signature []byte) bool {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, signature) == nil
+
+	case *ecdsa.PublicKey:
+		var sig struct {
+			R, S *big.Int
+		}
+
+		if rest, err := asn1.Unmarshal(signature, &sig); err != nil || len(rest) > 0 {
+			return false
+		}
+
+		return ecdsa.Verify(k, digest, sig.R, sig.S)
+	}
+
+	return false
+}
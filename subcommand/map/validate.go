@@ -0,0 +1,383 @@
+package mapcmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	bettererrors "github.com/xtuc/better-errors"
+
+	"github.com/bytearena/core/common/mappack"
+	"github.com/bytearena/core/common/types/mapcontainer"
+)
+
+const (
+	MAP_JSON_FILENAME = "map.json"
+
+	// Starting positions closer than this would spawn agents into each other
+	MIN_START_DISTANCE = 1.0
+)
+
+var (
+	MAP_ASSET_EXTENSIONS = []string{
+		".gltf", ".glb", ".bin", ".obj", ".mtl", ".png", ".jpg", ".jpeg", ".svg", ".md",
+	}
+)
+
+// MapProblem is an error found in a map pack, located by the file and the
+// path of the faulty value in it.
+type MapProblem struct {
+	File     string
+	Location string
+	Message  string
+}
+
+func (p MapProblem) String() string {
+	if p.Location == "" {
+		return fmt.Sprintf("%s: %s", p.File, p.Message)
+	}
+
+	return fmt.Sprintf("%s: %s: %s", p.File, p.Location, p.Message)
+}
+
+func MapValidateAction(mapname string) error {
+	if mapname == "" {
+		return bettererrors.New("No map was specified")
+	}
+
+	problems, err := ValidateMap(mapname)
+	if err != nil {
+		return err
+	}
+
+	for _, problem := range problems {
+		fmt.Println(problem.String())
+	}
+
+	if len(problems) > 0 {
+		return bettererrors.
+			New("Map is not valid").
+			SetContext("map", mapname).
+			SetContext("problems", fmt.Sprintf("%d", len(problems)))
+	}
+
+	fmt.Printf("[OK] Map %s is valid\n", mapname)
+
+	return nil
+}
+
+// ValidateMap checks a map pack given by name or path; the error is only set
+// when the map could not be checked at all.
+func ValidateMap(mapname string) ([]MapProblem, error) {
+	location, release, err := ResolveMapLocation(mapname)
+	if err != nil {
+		return nil, err
+	}
+
+	defer release()
+
+	return validateMapFile(location)
+}
+
+func validateMapFile(location string) ([]MapProblem, error) {
+	bundle, err := mappack.UnzipAndGetHandles(location)
+	if err != nil {
+		return nil, bettererrors.
+			New("Could not open map pack").
+			With(err).
+			SetContext("location", location)
+	}
+
+	return validateMapBundle(bundle), nil
+}
+
+// mapFiles is what validation reads of a map pack.
+type mapFiles interface {
+	Open(name string) ([]byte, error)
+}
+
+func validateMapBundle(bundle mapFiles) []MapProblem {
+	jsonsource, err := bundle.Open(MAP_JSON_FILENAME)
+	if err != nil {
+		return []MapProblem{
+			{File: MAP_JSON_FILENAME, Message: "file is missing from the map pack"},
+		}
+	}
+
+	problems := validateMapSchema(jsonsource)
+	if len(problems) > 0 {
+		return problems
+	}
+
+	var mapContainer mapcontainer.MapContainer
+	if err := json.Unmarshal(jsonsource, &mapContainer); err != nil {
+		return []MapProblem{jsonErrorToProblem(jsonsource, err)}
+	}
+
+	problems = append(problems, validateMapGeometry(&mapContainer)...)
+	problems = append(problems, validateMapAssets(bundle, jsonsource)...)
+
+	return problems
+}
+
+// validateMapSchema checks that the structure expected by the game is there.
+func validateMapSchema(jsonsource []byte) []MapProblem {
+	var document map[string]interface{}
+
+	if err := json.Unmarshal(jsonsource, &document); err != nil {
+		return []MapProblem{jsonErrorToProblem(jsonsource, err)}
+	}
+
+	problems := make([]MapProblem, 0)
+
+	expectObject := func(parent map[string]interface{}, key, location string) map[string]interface{} {
+		value, ok := parent[key]
+
+		if !ok {
+			problems = append(problems, MapProblem{File: MAP_JSON_FILENAME, Location: location, Message: "is missing"})
+			return nil
+		}
+
+		object, ok := value.(map[string]interface{})
+
+		if !ok {
+			problems = append(problems, MapProblem{File: MAP_JSON_FILENAME, Location: location, Message: "must be an object"})
+			return nil
+		}
+
+		return object
+	}
+
+	expectArray := func(parent map[string]interface{}, key, location string) {
+		value, ok := parent[key]
+
+		if !ok {
+			problems = append(problems, MapProblem{File: MAP_JSON_FILENAME, Location: location, Message: "is missing"})
+			return
+		}
+
+		if _, ok := value.([]interface{}); !ok {
+			problems = append(problems, MapProblem{File: MAP_JSON_FILENAME, Location: location, Message: "must be an array"})
+		}
+	}
+
+	expectObject(document, "meta", "meta")
+
+	if data := expectObject(document, "data", "data"); data != nil {
+		expectArray(data, "grounds", "data.grounds")
+		expectArray(data, "starts", "data.starts")
+
+		if _, ok := data["obstacles"]; ok {
+			expectArray(data, "obstacles", "data.obstacles")
+		}
+	}
+
+	return problems
+}
+
+func validateMapGeometry(mapContainer *mapcontainer.MapContainer) []MapProblem {
+	problems := make([]MapProblem, 0)
+
+	add := func(location, format string, a ...interface{}) {
+		problems = append(problems, MapProblem{
+			File:     MAP_JSON_FILENAME,
+			Location: location,
+			Message:  fmt.Sprintf(format, a...),
+		})
+	}
+
+	grounds := mapContainer.Data.Grounds
+	starts := mapContainer.Data.Starts
+	obstacles := mapContainer.Data.Obstacles
+
+	if len(grounds) == 0 {
+		add("data.grounds", "the arena has no ground")
+	}
+
+	outlines := make([][]mapcontainer.MapPoint, 0)
+
+	for i, ground := range grounds {
+		if len(ground.Outline) == 0 {
+			add(fmt.Sprintf("data.grounds[%d].outline", i), "ground has no outline")
+		}
+
+		for j, polygon := range ground.Outline {
+			location := fmt.Sprintf("data.grounds[%d].outline[%d]", i, j)
+
+			if countDistinctPoints(polygon.Points) < 3 {
+				add(location, "outline is not closed; it needs at least 3 distinct points")
+				continue
+			}
+
+			if polygonArea(polygon.Points) == 0 {
+				add(location, "outline has no area")
+				continue
+			}
+
+			outlines = append(outlines, polygon.Points)
+		}
+	}
+
+	for i, obstacle := range obstacles {
+		location := fmt.Sprintf("data.obstacles[%d].polygon", i)
+
+		if countDistinctPoints(obstacle.Polygon.Points) < 3 {
+			add(location, "obstacle %q is not closed; it needs at least 3 distinct points", obstacle.Name)
+			continue
+		}
+
+		if polygonArea(obstacle.Polygon.Points) == 0 {
+			add(location, "obstacle %q has no area", obstacle.Name)
+		}
+	}
+
+	if len(starts) == 0 {
+		add("data.starts", "the arena has no starting position")
+	}
+
+	if max := mapContainer.Meta.MaxContestants; max > 0 && len(starts) < max {
+		add("data.starts", "%d starting positions for %d contestants (meta.maxcontestants)", len(starts), max)
+	}
+
+	for i, start := range starts {
+		location := fmt.Sprintf("data.starts[%d].point", i)
+
+		inside := false
+		for _, outline := range outlines {
+			if isPointInPolygon(start.Point, outline) {
+				inside = true
+				break
+			}
+		}
+
+		if len(outlines) > 0 && !inside {
+			add(location, "starting position (%g, %g) is outside of the arena", start.Point[0], start.Point[1])
+		}
+
+		for j, obstacle := range obstacles {
+			if countDistinctPoints(obstacle.Polygon.Points) >= 3 && isPointInPolygon(start.Point, obstacle.Polygon.Points) {
+				add(location, "starting position (%g, %g) is inside obstacle data.obstacles[%d]", start.Point[0], start.Point[1], j)
+			}
+		}
+
+		for j := 0; j < i; j++ {
+			if distance(start.Point, starts[j].Point) < MIN_START_DISTANCE {
+				add(location, "starting position overlaps data.starts[%d]", j)
+			}
+		}
+	}
+
+	return problems
+}
+
+// validateMapAssets checks that the files referenced by map.json are in the
+// map pack.
+func validateMapAssets(bundle mapFiles, jsonsource []byte) []MapProblem {
+	var document interface{}
+	json.Unmarshal(jsonsource, &document)
+
+	references := make(map[string]string)
+	collectAssetReferences(document, "", references)
+
+	locations := make([]string, 0)
+	for location := range references {
+		locations = append(locations, location)
+	}
+
+	sort.Strings(locations)
+
+	problems := make([]MapProblem, 0)
+
+	for _, location := range locations {
+		asset := strings.TrimPrefix(path.Clean(references[location]), "/")
+
+		if _, err := bundle.Open(asset); err != nil {
+			problems = append(problems, MapProblem{
+				File:     MAP_JSON_FILENAME,
+				Location: location,
+				Message:  fmt.Sprintf("asset %q is missing from the map pack", asset),
+			})
+		}
+	}
+
+	return problems
+}
+
+func collectAssetReferences(value interface{}, location string, references map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			childLocation := key
+			if location != "" {
+				childLocation = location + "." + key
+			}
+
+			collectAssetReferences(child, childLocation, references)
+		}
+
+	case []interface{}:
+		for i, child := range v {
+			collectAssetReferences(child, fmt.Sprintf("%s[%d]", location, i), references)
+		}
+
+	case string:
+		if isAssetReference(v) {
+			references[location] = v
+		}
+	}
+}
+
+func isAssetReference(value string) bool {
+	if strings.Contains(value, "://") || strings.ContainsAny(value, " \n") {
+		return false
+	}
+
+	ext := strings.ToLower(path.Ext(value))
+
+	for _, assetExt := range MAP_ASSET_EXTENSIONS {
+		if ext == assetExt {
+			return true
+		}
+	}
+
+	return false
+}
+
+// jsonErrorToProblem locates a JSON decoding error by line and column.
+func jsonErrorToProblem(jsonsource []byte, err error) MapProblem {
+	var offset int64 = -1
+
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	}
+
+	if offset < 0 {
+		return MapProblem{File: MAP_JSON_FILENAME, Message: err.Error()}
+	}
+
+	if offset > int64(len(jsonsource)) {
+		offset = int64(len(jsonsource))
+	}
+
+	// Offsets count the bytes read, the faulty one or the end of the faulty
+	// value being the last
+	before := jsonsource[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndex(before, []byte("\n")) - 1
+
+	if column < 1 {
+		column = 1
+	}
+
+	return MapProblem{
+		File:     MAP_JSON_FILENAME,
+		Location: fmt.Sprintf("line %d, column %d", line, column),
+		Message:  err.Error(),
+	}
+}
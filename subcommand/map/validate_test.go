@@ -0,0 +1,207 @@
+package mapcmd
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/bytearena/core/common/types/mapcontainer"
+)
+
+// testMapFiles is a map pack held in memory.
+type testMapFiles map[string]string
+
+func (files testMapFiles) Open(name string) ([]byte, error) {
+	content, ok := files[name]
+
+	if !ok {
+		return nil, errors.New("no such file")
+	}
+
+	return []byte(content), nil
+}
+
+const (
+	TEST_GROUND = `{"id": "ground", "name": "Ground", "outline": [{"points": [[0, 0], [10, 0], [10, 10], [0, 10]]}]}`
+	TEST_STARTS = `{"id": 1, "name": "A", "point": [2, 2]}, {"id": 2, "name": "B", "point": [8, 8]}`
+)
+
+// testMapJSON returns a map.json with the given meta and data fields.
+func testMapJSON(meta, grounds, starts, obstacles string) string {
+	return `{
+    "meta": {` + meta + `},
+    "data": {
+        "grounds": [` + grounds + `],
+        "starts": [` + starts + `],
+        "obstacles": [` + obstacles + `]
+    }
+}`
+}
+
+func TestValidateMapBundle(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    testMapFiles
+		expected []string
+	}{
+		{
+			name: "valid",
+			files: testMapFiles{
+				MAP_JSON_FILENAME: testMapJSON(`"maxcontestants": 2, "preview": "preview.svg"`, TEST_GROUND, TEST_STARTS, `{"id": "rock", "name": "Rock", "polygon": {"points": [[4, 4], [6, 4], [5, 6]]}}`),
+				"preview.svg":     "<svg/>",
+			},
+			expected: []string{},
+		},
+		{
+			name:     "missing map.json",
+			files:    testMapFiles{},
+			expected: []string{"map.json: file is missing from the map pack"},
+		},
+		{
+			name:     "schema",
+			files:    testMapFiles{MAP_JSON_FILENAME: `{"data": {"grounds": {}, "obstacles": 1}}`},
+			expected: []string{"map.json: meta: is missing", "map.json: data.grounds: must be an array", "map.json: data.starts: is missing", "map.json: data.obstacles: must be an array"},
+		},
+		{
+			name:  "no ground nor start",
+			files: testMapFiles{MAP_JSON_FILENAME: testMapJSON("", "", "", "")},
+			expected: []string{
+				"map.json: data.grounds: the arena has no ground",
+				"map.json: data.starts: the arena has no starting position",
+			},
+		},
+		{
+			name: "grounds",
+			files: testMapFiles{MAP_JSON_FILENAME: testMapJSON("",
+				TEST_GROUND+`, {"id": "empty", "outline": []}, {"id": "open", "outline": [{"points": [[0, 0], [1, 1], [0, 0]]}]}, {"id": "flat", "outline": [{"points": [[0, 0], [1, 1], [2, 2]]}]}`,
+				TEST_STARTS, "")},
+			expected: []string{
+				"map.json: data.grounds[1].outline: ground has no outline",
+				"map.json: data.grounds[2].outline[0]: outline is not closed; it needs at least 3 distinct points",
+				"map.json: data.grounds[3].outline[0]: outline has no area",
+			},
+		},
+		{
+			name: "obstacles",
+			files: testMapFiles{MAP_JSON_FILENAME: testMapJSON("", TEST_GROUND, TEST_STARTS,
+				`{"name": "line", "polygon": {"points": [[1, 1], [2, 2]]}}, {"name": "flat", "polygon": {"points": [[1, 1], [2, 2], [3, 3]]}}`)},
+			expected: []string{
+				`map.json: data.obstacles[0].polygon: obstacle "line" is not closed; it needs at least 3 distinct points`,
+				`map.json: data.obstacles[1].polygon: obstacle "flat" has no area`,
+			},
+		},
+		{
+			name: "starts",
+			files: testMapFiles{MAP_JSON_FILENAME: testMapJSON(`"maxcontestants": 5`, TEST_GROUND,
+				`{"point": [2, 2]}, {"point": [12, 2]}, {"point": [5, 5]}, {"point": [2.5, 2]}`,
+				`{"name": "rock", "polygon": {"points": [[4, 4], [6, 4], [6, 6], [4, 6]]}}`)},
+			expected: []string{
+				"map.json: data.starts: 4 starting positions for 5 contestants (meta.maxcontestants)",
+				"map.json: data.starts[1].point: starting position (12, 2) is outside of the arena",
+				"map.json: data.starts[2].point: starting position (5, 5) is inside obstacle data.obstacles[0]",
+				"map.json: data.starts[3].point: starting position overlaps data.starts[0]",
+			},
+		},
+		{
+			name: "missing assets",
+			files: testMapFiles{
+				MAP_JSON_FILENAME: testMapJSON(`"preview": "preview.svg", "readme": "/README.md", "repository": "https://example.com/map.md"`, TEST_GROUND, TEST_STARTS, ""),
+				"README.md":       "# Map",
+			},
+			expected: []string{`map.json: meta.preview: asset "preview.svg" is missing from the map pack`},
+		},
+	}
+
+	for _, test := range tests {
+		actual := make([]string, 0)
+
+		for _, problem := range validateMapBundle(test.files) {
+			actual = append(actual, problem.String())
+		}
+
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestJSONErrorLocation(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{
+			name:     "syntax error",
+			source:   "{\n    \"meta\": {},\n    \"data\": {,}\n}",
+			expected: "line 3, column 14",
+		},
+		{
+			name:     "syntax error on the first column",
+			source:   "}",
+			expected: "line 1, column 1",
+		},
+		{
+			name:     "unexpected end",
+			source:   "{\n    \"meta\": {}",
+			expected: "line 2, column 14",
+		},
+		{
+			name:     "type error",
+			source:   testMapJSON("", TEST_GROUND, `{"id": 1, "name": "A", "point": "center"}`, ""),
+			expected: "line 5, column 59",
+		},
+	}
+
+	for _, test := range tests {
+		var mapContainer mapcontainer.MapContainer
+
+		err := json.Unmarshal([]byte(test.source), &mapContainer)
+		if err == nil {
+			t.Errorf("%s: expected a JSON error", test.name)
+			continue
+		}
+
+		problem := jsonErrorToProblem([]byte(test.source), err)
+
+		if problem.File != MAP_JSON_FILENAME || problem.Location != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, problem.String())
+		}
+	}
+
+	// Schema problems come before the decoding of the map
+	problems := validateMapBundle(testMapFiles{MAP_JSON_FILENAME: "{\n    \"meta\": {},\n    \"data\": {,}\n}"})
+
+	if len(problems) != 1 || problems[0].Location != "line 3, column 14" {
+		t.Errorf("syntax error of a map pack: expected it located at line 3, column 14, got %v", problems)
+	}
+}
+
+func TestPolygonGeometry(t *testing.T) {
+	square := []mapcontainer.MapPoint{{0, 0}, {10, 0}, {10, 10}, {0, 10}}
+	concave := []mapcontainer.MapPoint{{0, 0}, {10, 0}, {10, 10}, {5, 5}, {0, 10}}
+
+	tests := []struct {
+		name           string
+		polygon        []mapcontainer.MapPoint
+		point          mapcontainer.MapPoint
+		expectedInside bool
+		expectedArea   float64
+	}{
+		{"inside", square, mapcontainer.MapPoint{5, 5}, true, 100},
+		{"outside", square, mapcontainer.MapPoint{15, 5}, false, 100},
+		{"notch of a concave polygon", concave, mapcontainer.MapPoint{5, 8}, false, 75},
+		{"concave polygon", concave, mapcontainer.MapPoint{8, 8}, true, 75},
+	}
+
+	for _, test := range tests {
+		if actual := isPointInPolygon(test.point, test.polygon); actual != test.expectedInside {
+			t.Errorf("%s: expected inside %v, got %v", test.name, test.expectedInside, actual)
+		}
+
+		if actual := polygonArea(test.polygon); actual != test.expectedArea {
+			t.Errorf("%s: expected area %g, got %g", test.name, test.expectedArea, actual)
+		}
+	}
+}
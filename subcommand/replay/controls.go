@@ -0,0 +1,156 @@
+package replay
+
+import (
+	"encoding/json"
+	"html/template"
+	"net"
+	"net/http"
+	"strconv"
+
+	bettererrors "github.com/xtuc/better-errors"
+)
+
+// The visualization is served by core; its page is framed by this one, which
+// adds the playback controls.
+var controlsPage = template.Must(template.New("controls").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Byte Arena replay</title>
+<style>
+	html, body { margin: 0; height: 100%; font-family: sans-serif; }
+	body { display: flex; flex-direction: column; }
+	iframe { flex: 1; border: 0; }
+	#controls { display: flex; align-items: center; gap: 12px; padding: 8px; background: #222; color: #eee; }
+	#seek { flex: 1; }
+</style>
+</head>
+<body>
+<iframe src="{{.VizURL}}"></iframe>
+<div id="controls">
+	<button id="toggle">Pause</button>
+	<input id="seek" type="range" min="0" max="0" step="0.1" value="0">
+	<span id="time">0.0s / 0.0s</span>
+	<select id="speed">
+		<option value="0.25">0.25x</option>
+		<option value="0.5">0.5x</option>
+		<option value="1" selected>1x</option>
+		<option value="2">2x</option>
+		<option value="4">4x</option>
+	</select>
+</div>
+<script>
+	var toggle = document.getElementById("toggle");
+	var seek = document.getElementById("seek");
+	var time = document.getElementById("time");
+	var speed = document.getElementById("speed");
+	var seeking = false;
+
+	function send(action, value) {
+		var url = "control/" + action + (value === undefined ? "" : "?value=" + value);
+		return fetch(url, { method: "POST" }).then(refresh);
+	}
+
+	function refresh() {
+		return fetch("control/status").then(function (res) { return res.json(); }).then(function (status) {
+			toggle.textContent = status.paused ? "Play" : "Pause";
+			seek.max = status.duration;
+			if (!seeking) { seek.value = status.position; }
+			time.textContent = status.position.toFixed(1) + "s / " + status.duration.toFixed(1) + "s";
+			speed.value = String(status.speed);
+		});
+	}
+
+	toggle.onclick = function () { send(toggle.textContent === "Play" ? "play" : "pause"); };
+	seek.oninput = function () { seeking = true; };
+	seek.onchange = function () { seeking = false; send("seek", seek.value); };
+	speed.onchange = function () { send("speed", speed.value); };
+
+	setInterval(refresh, 500);
+	refresh();
+</script>
+</body>
+</html>
+`))
+
+type playerStatus struct {
+	Position float64 `json:"position"`
+	Duration float64 `json:"duration"`
+	Paused   bool    `json:"paused"`
+	Speed    float64 `json:"speed"`
+}
+
+// serveControls serves the replay page with its playback controls, and the
+// endpoints they call.
+func serveControls(addr string, vizURL string, p *player) (*http.Server, error) {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		controlsPage.Execute(w, struct{ VizURL string }{vizURL})
+	})
+
+	mux.HandleFunc("/control/status", func(w http.ResponseWriter, r *http.Request) {
+		position, duration, paused := p.Status()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(playerStatus{
+			Position: position,
+			Duration: duration,
+			Paused:   paused,
+			Speed:    p.Speed(),
+		})
+	})
+
+	mux.HandleFunc("/control/play", controlHandler(func(float64) { p.SetPaused(false) }, false))
+	mux.HandleFunc("/control/pause", controlHandler(func(float64) { p.SetPaused(true) }, false))
+	mux.HandleFunc("/control/seek", controlHandler(p.Seek, true))
+	mux.HandleFunc("/control/speed", controlHandler(func(speed float64) {
+		if speed > 0 {
+			p.SetSpeed(speed)
+		}
+	}, true))
+
+	listener, err := net.Listen("tcp", addr)
+
+	if err != nil {
+		return nil, bettererrors.
+			New("Could not serve the replay controls").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("address", addr)
+	}
+
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+
+	return server, nil
+}
+
+func controlHandler(action func(value float64), hasValue bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var value float64
+
+		if hasValue {
+			var err error
+
+			value, err = strconv.ParseFloat(r.URL.Query().Get("value"), 64)
+			if err != nil {
+				http.Error(w, "Invalid value", http.StatusBadRequest)
+				return
+			}
+		}
+
+		action(value)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,245 @@
+package replay
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skratchdot/open-golang/open"
+	bettererrors "github.com/xtuc/better-errors"
+
+	"github.com/bytearena/core/common"
+	"github.com/bytearena/core/common/mappack"
+	"github.com/bytearena/core/common/recording"
+	"github.com/bytearena/core/common/visualization"
+	viztypes "github.com/bytearena/core/common/visualization/types"
+	"github.com/bytearena/core/game/deathmatch"
+
+	mapcmd "github.com/bytearena/ba/subcommand/map"
+	"github.com/bytearena/ba/subcommand/train"
+)
+
+const (
+	SHOW_USAGE      = true
+	DONT_SHOW_USAGE = false
+)
+
+type ReplayActionArguments struct {
+	RecordFile string
+	MapName    string
+	Tps        int
+	Speed      float64
+	Vizport    int
+	Vizhost    string
+
+	// Port of the page with the playback controls; the one after Vizport
+	// if not set
+	Controlport int
+	Nobrowser   bool
+}
+
+func ReplayAction(args ReplayActionArguments) (bool, error) {
+	if args.RecordFile == "" {
+		return SHOW_USAGE, bettererrors.New("No record file was specified")
+	}
+
+	// The map and the pace of the game are taken from the record metadata
+	// unless they are given explicitly
+	metadata, metadataErr := train.ReadRecordMetadata(args.RecordFile)
+
+	if args.MapName == "" {
+		if metadataErr != nil {
+			return SHOW_USAGE, bettererrors.
+				New("The map of the record is unknown; you can specify it using the `--map` flag").
+				With(metadataErr)
+		}
+
+		args.MapName = metadata.MapName
+	}
+
+	if args.Tps <= 0 {
+		args.Tps = metadata.Tps
+	}
+
+	if args.Tps <= 0 {
+		args.Tps = 20
+	}
+
+	if args.Speed <= 0 {
+		args.Speed = 1
+	}
+
+	frames, err := train.ReadRecordFrames(args.RecordFile)
+	if err != nil {
+		return DONT_SHOW_USAGE, err
+	}
+
+	if len(frames) == 0 {
+		return DONT_SHOW_USAGE, bettererrors.
+			New("Record file contains no frames").
+			SetContext("filename", args.RecordFile)
+	}
+
+	mapLocation, releaseMapLocation, err := mapcmd.ResolveMapLocation(args.MapName)
+	if err != nil {
+		return DONT_SHOW_USAGE, err
+	}
+
+	defer releaseMapLocation()
+
+	mapcmd.RecordMapUsage(args.MapName)
+
+	mappack, err := mappack.UnzipAndGetHandles(mapLocation)
+	if err != nil {
+		return DONT_SHOW_USAGE, err
+	}
+
+	gamedescription, err := train.NewMockGame(args.Tps, time.Now(), mappack)
+	if err != nil {
+		return DONT_SHOW_USAGE, err
+	}
+
+	game := deathmatch.NewDeathmatchGame(gamedescription)
+
+	vizgames := []*viztypes.VizGame{
+		viztypes.NewVizGame(game, gamedescription),
+	}
+
+	vizservice := visualization.NewVizService(
+		args.Vizhost+":"+strconv.Itoa(args.Vizport),
+		mapcmd.GetMapName(args.MapName),
+		func() ([]*viztypes.VizGame, error) { return vizgames, nil },
+		recording.MakeEmptyRecorder(),
+		mappack,
+	)
+
+	vizservice.Start()
+	defer vizservice.Stop()
+
+	p := newPlayer(gamedescription.GetId(), frames, args.Tps, args.Speed)
+
+	go p.Run()
+	defer p.Stop()
+
+	vizURL := "http://" + args.Vizhost + ":" + strconv.Itoa(args.Vizport) + "/arena/" + gamedescription.GetId()
+
+	if args.Controlport <= 0 {
+		args.Controlport = args.Vizport + 1
+	}
+
+	controls, err := serveControls(args.Vizhost+":"+strconv.Itoa(args.Controlport), vizURL, p)
+	if err != nil {
+		return DONT_SHOW_USAGE, err
+	}
+
+	defer controls.Close()
+
+	url := "http://" + args.Vizhost + ":" + strconv.Itoa(args.Controlport) + "/"
+
+	if !args.Nobrowser {
+		open.Run(url)
+	}
+
+	fmt.Printf(train.HeadsUpColor("[headsup] Replay running at %s\n"), url)
+	printControls()
+
+	quit := make(chan bool, 1)
+
+	go func() {
+		<-common.SignalHandler()
+		quit <- true
+	}()
+
+	go readControls(p, quit)
+
+	<-quit
+
+	return DONT_SHOW_USAGE, nil
+}
+
+func printControls() {
+	fmt.Println("")
+	fmt.Println("Controls (followed by enter):")
+	fmt.Println("  p            pause / resume")
+	fmt.Println("  s <seconds>  seek to the given time")
+	fmt.Println("  x <speed>    set the playback speed (e.g. 0.5, 2)")
+	fmt.Println("  i            show the current position")
+	fmt.Println("  q            quit")
+	fmt.Println("")
+}
+
+func readControls(p *player, quit chan bool) {
+	scanner := bufio.NewScanner(os.Stdin)
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "p":
+			if p.TogglePause() {
+				fmt.Println("Paused")
+			} else {
+				fmt.Println("Playing")
+			}
+
+		case "s":
+			seconds, err := parseControlArgument(fields)
+			if err != nil {
+				fmt.Println(err.Error())
+				continue
+			}
+
+			p.Seek(seconds)
+
+		case "x":
+			speed, err := parseControlArgument(fields)
+			if err != nil || speed <= 0 {
+				fmt.Println("Invalid speed")
+				continue
+			}
+
+			p.SetSpeed(speed)
+
+		case "i":
+			position, duration, paused := p.Status()
+
+			status := "playing"
+			if paused {
+				status = "paused"
+			}
+
+			fmt.Printf("%.1fs / %.1fs (%s)\n", position, duration, status)
+
+		case "q":
+			quit <- true
+			return
+
+		default:
+			printControls()
+		}
+	}
+
+	// stdin is closed; keep playing until interrupted
+}
+
+func parseControlArgument(fields []string) (float64, error) {
+	if len(fields) < 2 {
+		return 0, bettererrors.New("Missing value")
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return 0, bettererrors.
+			New("Invalid value").
+			SetContext("value", fields[1])
+	}
+
+	return value, nil
+}
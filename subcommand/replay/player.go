@@ -0,0 +1,125 @@
+package replay
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	notify "github.com/bitly/go-notify"
+)
+
+// player streams the frames of a record to the visualization at the pace of
+// the recorded game.
+type player struct {
+	mutex    sync.Mutex
+	gameID   string
+	frames   []string
+	tps      int
+	position int
+	speed    float64
+	paused   bool
+	stop     chan bool
+}
+
+func newPlayer(gameID string, frames []string, tps int, speed float64) *player {
+	return &player{
+		gameID: gameID,
+		frames: frames,
+		tps:    tps,
+		speed:  speed,
+		stop:   make(chan bool),
+	}
+}
+
+func (p *player) Run() {
+	for {
+		p.mutex.Lock()
+		tick := time.Duration(float64(time.Second) / (float64(p.tps) * p.speed))
+
+		if !p.paused && p.position < len(p.frames) {
+			notify.PostTimeout("viz:message:"+p.gameID, p.frames[p.position], time.Millisecond)
+			p.position++
+
+			if p.position == len(p.frames) {
+				p.paused = true
+				fmt.Println("End of record; seek back and resume to play it again.")
+			}
+		}
+		p.mutex.Unlock()
+
+		select {
+		case <-p.stop:
+			return
+		case <-time.After(tick):
+		}
+	}
+}
+
+func (p *player) Stop() {
+	close(p.stop)
+}
+
+func (p *player) TogglePause() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.paused = !p.paused
+
+	return p.paused
+}
+
+// Seek moves to the given time of the record, in seconds.
+func (p *player) Seek(seconds float64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	position := int(seconds * float64(p.tps))
+
+	if position < 0 {
+		position = 0
+	}
+
+	if position >= len(p.frames) {
+		position = len(p.frames) - 1
+	}
+
+	p.position = position
+}
+
+// SetPaused pauses or resumes the playback; resuming at the end of the
+// record plays it again.
+func (p *player) SetPaused(paused bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if !paused && p.position >= len(p.frames) {
+		p.position = 0
+	}
+
+	p.paused = paused
+}
+
+func (p *player) Speed() float64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.speed
+}
+
+func (p *player) SetSpeed(speed float64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.speed = speed
+}
+
+// Status returns the current time and the duration of the record, in
+// seconds.
+func (p *player) Status() (float64, float64, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	tps := float64(p.tps)
+
+	return float64(p.position) / tps, float64(len(p.frames)) / tps, p.paused
+}
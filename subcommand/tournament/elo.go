@@ -0,0 +1,147 @@
+package tournament
+
+import (
+	"math"
+	"sort"
+
+	"github.com/bytearena/ba/subcommand/train"
+)
+
+const (
+	ELO_INITIAL_RATING = 1500
+	ELO_K_FACTOR       = 32
+)
+
+type LeaderboardEntry struct {
+	Agent   string  `json:"agent"`
+	Rating  float64 `json:"rating"`
+	Matches int     `json:"matches"`
+	Wins    int     `json:"wins"`
+	Kills   int     `json:"kills"`
+	Deaths  int     `json:"deaths"`
+	Score   int     `json:"score"`
+}
+
+// leaderboard rates the agents with Elo, a match between several agents
+// counting as one game between every pair of them.
+type leaderboard struct {
+	entries map[string]*LeaderboardEntry
+}
+
+func newLeaderboard(agents []string) *leaderboard {
+	l := &leaderboard{
+		entries: make(map[string]*LeaderboardEntry),
+	}
+
+	for _, agent := range agents {
+		l.get(agent)
+	}
+
+	return l
+}
+
+func (l *leaderboard) get(agent string) *LeaderboardEntry {
+	entry, ok := l.entries[agent]
+
+	if !ok {
+		entry = &LeaderboardEntry{
+			Agent:  agent,
+			Rating: ELO_INITIAL_RATING,
+		}
+
+		l.entries[agent] = entry
+	}
+
+	return entry
+}
+
+func (l *leaderboard) Record(result train.MatchResult) {
+	n := len(result.Agents)
+
+	if n < 2 {
+		return
+	}
+
+	// Pairwise updates are computed from the ratings before the match and
+	// shared among the opponents
+	k := ELO_K_FACTOR / float64(n-1)
+	deltas := make([]float64, n)
+
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			a := l.get(result.Agents[i].Agent)
+			b := l.get(result.Agents[j].Agent)
+
+			expected := 1 / (1 + math.Pow(10, (b.Rating-a.Rating)/400))
+			actual := compareResults(result.Agents[i], result.Agents[j])
+
+			deltas[i] += k * (actual - expected)
+			deltas[j] -= k * (actual - expected)
+		}
+	}
+
+	for i, agent := range result.Agents {
+		entry := l.get(agent.Agent)
+
+		entry.Rating += deltas[i]
+		entry.Matches++
+		entry.Kills += agent.Kills
+		entry.Deaths += agent.Deaths
+		entry.Score += agent.Score
+
+		if hasBeatenEveryone(i, result.Agents) {
+			entry.Wins++
+		}
+	}
+}
+
+func (l *leaderboard) Entries() []LeaderboardEntry {
+	entries := make([]LeaderboardEntry, 0)
+
+	for _, entry := range l.entries {
+		entries = append(entries, *entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Rating == entries[j].Rating {
+			return entries[i].Agent < entries[j].Agent
+		}
+
+		return entries[i].Rating > entries[j].Rating
+	})
+
+	return entries
+}
+
+// compareResults returns 1 when a did better than b, 0 when it did worse and
+// 0.5 on a draw.
+func compareResults(a, b train.AgentResult) float64 {
+	switch {
+	case a.Score != b.Score:
+		return boolToOutcome(a.Score > b.Score)
+	case a.Deaths != b.Deaths:
+		return boolToOutcome(a.Deaths < b.Deaths)
+	case a.SurvivalSeconds != b.SurvivalSeconds:
+		return boolToOutcome(a.SurvivalSeconds > b.SurvivalSeconds)
+	}
+
+	return 0.5
+}
+
+func hasBeatenEveryone(index int, results []train.AgentResult) bool {
+	for i, other := range results {
+		if i != index && compareResults(results[index], other) < 1 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func boolToOutcome(won bool) float64 {
+	if won {
+		return 1
+	}
+
+	return 0
+}
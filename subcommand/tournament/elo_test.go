@@ -0,0 +1,100 @@
+package tournament
+
+import (
+	"math"
+	"testing"
+
+	"github.com/bytearena/ba/subcommand/train"
+)
+
+func TestCompareResults(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     train.AgentResult
+		expected float64
+	}{
+		{"higher score wins", train.AgentResult{Score: 3}, train.AgentResult{Score: 1}, 1},
+		{"lower score loses", train.AgentResult{Score: 1}, train.AgentResult{Score: 3}, 0},
+		{"fewer deaths break ties", train.AgentResult{Score: 2, Deaths: 1}, train.AgentResult{Score: 2, Deaths: 4}, 1},
+		{"survival breaks ties", train.AgentResult{SurvivalSeconds: 10}, train.AgentResult{SurvivalSeconds: 20}, 0},
+		{"draw", train.AgentResult{Score: 2, Deaths: 1}, train.AgentResult{Score: 2, Deaths: 1}, 0.5},
+	}
+
+	for _, test := range tests {
+		if actual := compareResults(test.a, test.b); actual != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestLeaderboardRecord(t *testing.T) {
+	tests := []struct {
+		name    string
+		agents  []train.AgentResult
+		ratings map[string]float64
+		wins    map[string]int
+	}{
+		{
+			name: "win between equals",
+			agents: []train.AgentResult{
+				{Agent: "a", Score: 2},
+				{Agent: "b", Score: 1},
+			},
+			ratings: map[string]float64{"a": 1516, "b": 1484},
+			wins:    map[string]int{"a": 1, "b": 0},
+		},
+		{
+			name: "draw between equals",
+			agents: []train.AgentResult{
+				{Agent: "a", Score: 1},
+				{Agent: "b", Score: 1},
+			},
+			ratings: map[string]float64{"a": 1500, "b": 1500},
+			wins:    map[string]int{"a": 0, "b": 0},
+		},
+		{
+			name: "three agents share the K factor",
+			agents: []train.AgentResult{
+				{Agent: "a", Score: 3},
+				{Agent: "b", Score: 2},
+				{Agent: "c", Score: 1},
+			},
+			ratings: map[string]float64{"a": 1516, "b": 1500, "c": 1484},
+			wins:    map[string]int{"a": 1, "b": 0, "c": 0},
+		},
+	}
+
+	for _, test := range tests {
+		board := newLeaderboard([]string{"a", "b", "c"})
+		board.Record(train.MatchResult{Agents: test.agents})
+
+		for agent, rating := range test.ratings {
+			entry := board.get(agent)
+
+			if math.Abs(entry.Rating-rating) > 1e-9 {
+				t.Errorf("%s: expected %s to be rated %v, got %v", test.name, agent, rating, entry.Rating)
+			}
+
+			if entry.Wins != test.wins[agent] {
+				t.Errorf("%s: expected %s to have %d wins, got %d", test.name, agent, test.wins[agent], entry.Wins)
+			}
+		}
+	}
+}
+
+func TestLeaderboardEntries(t *testing.T) {
+	board := newLeaderboard([]string{"b", "a", "c"})
+	board.Record(train.MatchResult{Agents: []train.AgentResult{
+		{Agent: "c", Score: 1},
+		{Agent: "b", Score: 0},
+	}})
+
+	entries := board.Entries()
+	expected := []string{"c", "a", "b"}
+
+	for i, agent := range expected {
+		if entries[i].Agent != agent {
+			t.Errorf("expected %s at rank %d, got %s", agent, i+1, entries[i].Agent)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package tournament
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	bettererrors "github.com/xtuc/better-errors"
+
+	"github.com/bytearena/core/arenaserver"
+	"github.com/bytearena/core/common"
+	"github.com/bytearena/core/common/utils"
+
+	"github.com/bytearena/ba/subcommand/train"
+)
+
+const (
+	SHOW_USAGE      = true
+	DONT_SHOW_USAGE = false
+)
+
+type TournamentActionArguments struct {
+	Tps             int
+	Host            string
+	Agentimages     []string
+	MapNames        []string
+	GroupSize       int
+	Rounds          int
+	DurationSeconds int
+	ReportFile      string
+	IsDebug         bool
+	IsQuiet         bool
+}
+
+type tournamentReport struct {
+	Matches     []train.MatchResult `json:"matches"`
+	Leaderboard []LeaderboardEntry  `json:"leaderboard"`
+}
+
+func TournamentAction(args TournamentActionArguments) (bool, error) {
+	if len(args.Agentimages) < 2 {
+		return SHOW_USAGE, bettererrors.New("A tournament needs at least two agents")
+	}
+
+	if args.GroupSize < 2 || args.GroupSize > len(args.Agentimages) {
+		return SHOW_USAGE, bettererrors.
+			New("Invalid group size; it must be between 2 and the number of agents").
+			SetContext("group size", fmt.Sprintf("%d", args.GroupSize))
+	}
+
+	if args.DurationSeconds <= 0 {
+		return SHOW_USAGE, bettererrors.New("Tournament matches require a `--duration`")
+	}
+
+	if len(args.MapNames) == 0 {
+		return SHOW_USAGE, bettererrors.New("No maps were specified")
+	}
+
+	if args.Rounds <= 0 {
+		args.Rounds = 1
+	}
+
+	if args.Host == "" {
+		ip, err := utils.GetCurrentIP()
+		utils.Check(err, "Could not determine host IP; you can specify using the `--host` flag.")
+		args.Host = ip
+	}
+
+	train.RunPreflightChecks()
+
+	logger, err := train.NewEventLogger(train.TrainActionArguments{
+		IsDebug: args.IsDebug,
+		IsQuiet: args.IsQuiet,
+	})
+
+	if err != nil {
+		return DONT_SHOW_USAGE, err
+	}
+
+	defer logger.Close()
+
+	shutdownChan := make(chan bool, 1)
+
+	go func() {
+		<-common.SignalHandler()
+		shutdownChan <- true
+	}()
+
+	duration := time.Duration(args.DurationSeconds) * time.Second
+	groups := getGroups(args.Agentimages, args.GroupSize)
+	total := len(args.MapNames) * len(groups) * args.Rounds
+
+	board := newLeaderboard(args.Agentimages)
+	results := make([]train.MatchResult, 0)
+
+	// A group is seated the same way in all its matches, so that rotating it
+	// gives each of its agents every seat
+	seed := time.Now().UnixNano()
+
+schedule:
+	for round := 0; round < args.Rounds; round++ {
+		for mapIndex, mapName := range args.MapNames {
+			for groupIndex, group := range groups {
+				number := len(results) + 1
+
+				// Agents spawn in the order they are registered
+				group = rotateGroup(group, round*len(args.MapNames)+mapIndex)
+
+				if !args.IsQuiet {
+					fmt.Printf(train.HeadsUpColor("[headsup] Match %d/%d on %s: %v\n"), number, total, mapName, group)
+				}
+
+				result, err := train.RunHeadlessMatch(train.TrainActionArguments{
+					Tps:             args.Tps,
+					Host:            args.Host,
+					MapName:         mapName,
+					Seed:            seed + int64(groupIndex),
+					SeedSet:         true,
+					DurationSeconds: args.DurationSeconds,
+					IsDebug:         args.IsDebug,
+					IsQuiet:         args.IsQuiet,
+				}, number, &duration, group, shutdownChan, logger)
+
+				if err != nil {
+					return DONT_SHOW_USAGE, err
+				}
+
+				results = append(results, result)
+
+				if result.Interrupted {
+					break schedule
+				}
+
+				// A failed match says nothing of the agents
+				if result.Error != "" {
+					logger.Log(arenaserver.EventHeadsUp{Value: fmt.Sprintf("Match %d failed: %s", number, result.Error)})
+					continue
+				}
+
+				board.Record(result)
+			}
+		}
+	}
+
+	leaderboard := board.Entries()
+	printLeaderboard(leaderboard)
+
+	if args.ReportFile != "" {
+		data, _ := json.MarshalIndent(tournamentReport{
+			Matches:     results,
+			Leaderboard: leaderboard,
+		}, "", "    ")
+
+		if err := ioutil.WriteFile(args.ReportFile, data, 0644); err != nil {
+			return DONT_SHOW_USAGE, bettererrors.
+				New("Could not write tournament report").
+				With(bettererrors.NewFromErr(err)).
+				SetContext("filename", args.ReportFile)
+		}
+	}
+
+	return DONT_SHOW_USAGE, nil
+}
+
+// getGroups returns every combination of size agents.
+func getGroups(agents []string, size int) [][]string {
+	groups := make([][]string, 0)
+
+	var combine func(start int, group []string)
+	combine = func(start int, group []string) {
+		if len(group) == size {
+			groups = append(groups, append([]string{}, group...))
+			return
+		}
+
+		for i := start; i < len(agents); i++ {
+			combine(i+1, append(group, agents[i]))
+		}
+	}
+
+	combine(0, make([]string, 0, size))
+
+	return groups
+}
+
+// rotateGroup shifts the seats of a group by n, so that every agent of the
+// group gets every spawn point over its matches.
+func rotateGroup(group []string, n int) []string {
+	rotated := make([]string, len(group))
+
+	for i := range group {
+		rotated[i] = group[(i+n)%len(group)]
+	}
+
+	return rotated
+}
+
+func printLeaderboard(entries []LeaderboardEntry) {
+	fmt.Println("")
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "RANK\tAGENT\tRATING\tMATCHES\tWINS\tKILLS\tDEATHS\tSCORE")
+
+	for i, entry := range entries {
+		fmt.Fprintf(
+			w,
+			"%d\t%s\t%.0f\t%d\t%d\t%d\t%d\t%d\n",
+			i+1,
+			entry.Agent,
+			entry.Rating,
+			entry.Matches,
+			entry.Wins,
+			entry.Kills,
+			entry.Deaths,
+			entry.Score,
+		)
+	}
+
+	w.Flush()
+}
@@ -0,0 +1,61 @@
+package tournament
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetGroups(t *testing.T) {
+	tests := []struct {
+		agents   []string
+		size     int
+		expected [][]string
+	}{
+		{
+			agents:   []string{"a", "b"},
+			size:     2,
+			expected: [][]string{{"a", "b"}},
+		},
+		{
+			agents:   []string{"a", "b", "c"},
+			size:     2,
+			expected: [][]string{{"a", "b"}, {"a", "c"}, {"b", "c"}},
+		},
+		{
+			agents:   []string{"a", "b", "c", "d"},
+			size:     3,
+			expected: [][]string{{"a", "b", "c"}, {"a", "b", "d"}, {"a", "c", "d"}, {"b", "c", "d"}},
+		},
+		{
+			agents:   []string{"a", "b", "c"},
+			size:     3,
+			expected: [][]string{{"a", "b", "c"}},
+		},
+	}
+
+	for _, test := range tests {
+		if actual := getGroups(test.agents, test.size); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("groups of %d among %v: expected %v, got %v", test.size, test.agents, test.expected, actual)
+		}
+	}
+}
+
+func TestRotateGroup(t *testing.T) {
+	tests := []struct {
+		group    []string
+		n        int
+		expected []string
+	}{
+		{[]string{"a", "b", "c"}, 0, []string{"a", "b", "c"}},
+		{[]string{"a", "b", "c"}, 1, []string{"b", "c", "a"}},
+		{[]string{"a", "b", "c"}, 2, []string{"c", "a", "b"}},
+		{[]string{"a", "b", "c"}, 3, []string{"a", "b", "c"}},
+		{[]string{"a", "b"}, 5, []string{"b", "a"}},
+	}
+
+	for _, test := range tests {
+		if actual := rotateGroup(test.group, test.n); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("rotating %v by %d: expected %v, got %v", test.group, test.n, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package train
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	bettererrors "github.com/xtuc/better-errors"
+
+	"github.com/bytearena/core/arenaserver"
+	"github.com/bytearena/core/common"
+	"github.com/bytearena/core/common/mq"
+	"github.com/bytearena/core/common/recording"
+	"github.com/bytearena/core/common/types"
+	"github.com/bytearena/core/common/utils"
+)
+
+// trainBatch runs the matches back to back without visualization and writes
+// a report of their results.
+func trainBatch(args TrainActionArguments, gameDuration *time.Duration, dockerImageNames []string, shutdownChan chan bool, logger EventLogger) error {
+	results := make([]MatchResult, 0)
+	failed := 0
+
+	for i := 1; i <= args.Matches; i++ {
+		if !args.IsQuiet {
+			logger.Log(arenaserver.EventHeadsUp{Value: fmt.Sprintf("Starting match %d/%d", i, args.Matches)})
+		}
+
+		// Each match of a seeded batch gets its own seed
+		matchArgs := args
+		if args.SeedSet {
+			matchArgs.Seed += int64(i - 1)
+		}
+
+		result, err := RunHeadlessMatch(matchArgs, i, gameDuration, dockerImageNames, shutdownChan, logger)
+		if err != nil {
+			return err
+		}
+
+		if i > 1 && result.MapChecksum != results[len(results)-1].MapChecksum {
+			logger.Log(arenaserver.EventHeadsUp{Value: "The map has changed since the previous match"})
+		}
+
+		if result.Error != "" {
+			failed++
+			logger.Log(arenaserver.EventHeadsUp{Value: fmt.Sprintf("Match %d failed: %s", i, result.Error)})
+		}
+
+		results = append(results, result)
+
+		if result.Interrupted {
+			break
+		}
+	}
+
+	if err := writeReport(args.ReportFile, args.ReportFormat, results); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return bettererrors.
+			New("Some matches failed").
+			SetContext("failed", strconv.Itoa(failed))
+	}
+
+	return nil
+}
+
+// RunHeadlessMatch runs a single match of the given agents without
+// visualization, until its duration elapses or something is sent on
+// shutdownChan.
+func RunHeadlessMatch(args TrainActionArguments, number int, gameDuration *time.Duration, dockerImageNames []string, shutdownChan chan bool, logger EventLogger) (MatchResult, error) {
+	result := MatchResult{
+		Match:   number,
+		MapName: args.MapName,
+	}
+
+	logger.NewMatch(number)
+
+	m, err := newMatch(args, gameDuration, dockerImageNames)
+	if err != nil {
+		return result, err
+	}
+
+	result.Seed = m.seed
+	result.MapChecksum = m.mapChecksum
+
+	stats := newMatchStats(args.Tps)
+
+	var recorder recording.RecorderInterface = recording.MakeEmptyRecorder()
+	if args.RecordFile != "" {
+		recordFile := getMatchRecordFile(args.RecordFile, number, args.Matches)
+
+		recorder, err = newRecorder(recordFile, m, args)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	gameID := m.gamedescription.GetId()
+	recorder.RecordMetadata(gameID, m.gamedescription.GetMapContainer())
+
+	m.brokerclient.Subscribe("viz", "message", func(msg mq.BrokerMessage) {
+		recorder.Record(gameID, string(msg.Data))
+		logger.NextTick()
+
+		if err := stats.Record(msg.Data); err != nil {
+			logger.Log(arenaserver.EventDebug{Value: "Could not read game state: " + err.Error()})
+		}
+	})
+
+	errs := make(chan error, 1)
+
+	go consumeEvents(m.srv, logger, errs)
+	go common.StreamState(m.srv, m.brokerclient, "trainer")
+
+	startedAt := time.Now()
+
+	serverShutdown, startErr := m.srv.Start()
+	if startErr != nil {
+		return result, startErr
+	}
+
+	select {
+	case <-serverShutdown:
+	case <-shutdownChan:
+		result.Interrupted = true
+	case err := <-errs:
+		result.Error = err.Error()
+	}
+
+	// Force quit if the server didn't stop
+	forceQuit := time.AfterFunc(TIME_BEFORE_FORCE_QUIT, func() {
+		utils.FailWith(bettererrors.New("Forced shutdown"))
+	})
+
+	m.srv.Stop()
+	forceQuit.Stop()
+
+	recorder.Close(gameID)
+	recorder.Stop()
+
+	result.StartedAt = startedAt.Format(time.RFC3339)
+	result.DurationSeconds = time.Since(startedAt).Seconds()
+	result.Agents = getAgentResults(m.agents, m.images, stats.Results())
+
+	return result, nil
+}
+
+// getAgentResults attaches the Docker image of each registered agent to its
+// results, images[i] being the one of agents[i]; agents which never showed up
+// in the game are reported as well.
+func getAgentResults(agents []*types.Agent, images []string, stats []AgentResult) []AgentResult {
+	results := make([]AgentResult, 0)
+	used := make(map[int]bool)
+
+	for i, agent := range agents {
+		result := AgentResult{
+			Id:    agent.Manifest.Id,
+			Name:  agent.Manifest.Name,
+			Agent: images[i],
+		}
+
+		for i, stat := range stats {
+			if used[i] {
+				continue
+			}
+
+			if stat.Name == agent.Manifest.Name || stat.Id == agent.Manifest.Id {
+				result = stat
+				result.Agent = images[i]
+				used[i] = true
+				break
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// getMatchRecordFile suffixes the record file with the match number when
+// several matches are recorded.
+func getMatchRecordFile(recordFile string, number, total int) string {
+	if total <= 1 {
+		return recordFile
+	}
+
+	ext := filepath.Ext(recordFile)
+
+	return strings.TrimSuffix(recordFile, ext) + "-" + strconv.Itoa(number) + ext
+}
@@ -0,0 +1,34 @@
+package train
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bytearena/core/common/types"
+)
+
+func TestGetAgentResults(t *testing.T) {
+	agents := []*types.Agent{
+		{Manifest: types.AgentManifest{Id: "seeker", Name: "Seeker"}},
+		{Manifest: types.AgentManifest{Id: "seeker", Name: "Seeker"}},
+		{Manifest: types.AgentManifest{Id: "runner", Name: "Runner"}},
+	}
+
+	// Two revisions of the same agent, told apart by their images
+	images := []string{"seeker:v1", "seeker:v2", "runner"}
+
+	stats := []AgentResult{
+		{Id: "seeker", Name: "Seeker", Score: 3},
+		{Id: "seeker", Name: "Seeker", Score: 1},
+	}
+
+	expected := []AgentResult{
+		{Agent: "seeker:v1", Id: "seeker", Name: "Seeker", Score: 3},
+		{Agent: "seeker:v2", Id: "seeker", Name: "Seeker", Score: 1},
+		{Agent: "runner", Id: "runner", Name: "Runner"},
+	}
+
+	if actual := getAgentResults(agents, images, stats); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
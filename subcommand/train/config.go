@@ -0,0 +1,209 @@
+package train
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	bettererrors "github.com/xtuc/better-errors"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/bytearena/ba/subcommand/build"
+)
+
+const (
+	TRAIN_CONFIG_FILENAME = "ba.train.yaml"
+)
+
+// TrainConfig is a training setup shared in a file, usually ba.train.yaml in
+// the current directory. Relative paths are relative to the file.
+type TrainConfig struct {
+	Tps             *int    `yaml:"tps"`
+	Host            *string `yaml:"host"`
+	MapName         *string `yaml:"map"`
+	DurationSeconds *int    `yaml:"duration"`
+	RecordFile      *string `yaml:"record-file"`
+	Viz             struct {
+		Host      *string `yaml:"host"`
+		Port      *int    `yaml:"port"`
+		Nobrowser *bool   `yaml:"no-browser"`
+	} `yaml:"viz"`
+	IsDebug      *bool   `yaml:"debug"`
+	IsQuiet      *bool   `yaml:"quiet"`
+	Headless     *bool   `yaml:"headless"`
+	Matches      *int    `yaml:"matches"`
+	ReportFile   *string `yaml:"report"`
+	ReportFormat *string `yaml:"report-format"`
+	Seed         *int64  `yaml:"seed"`
+	Output       *string `yaml:"output"`
+	OutputFile   *string `yaml:"output-file"`
+
+	Agents []TrainConfigAgent `yaml:"agents"`
+
+	dir string
+}
+
+// TrainConfigAgent is either an agent image or the path of an agent to watch.
+type TrainConfigAgent struct {
+	Image string `yaml:"image"`
+	Path  string `yaml:"path"`
+
+	// Number of instances of the agent in the game
+	Count int `yaml:"count"`
+
+	// Override the "build" section of the ba.json of an agent to watch, like
+	// the flags of `ba build`
+	BuildArgs []string `yaml:"build-args"`
+	NoCache   bool     `yaml:"no-cache"`
+}
+
+// FindTrainConfig returns the location of the config file in the current
+// directory, if any.
+func FindTrainConfig() (string, bool) {
+	if _, err := os.Stat(TRAIN_CONFIG_FILENAME); err != nil {
+		return "", false
+	}
+
+	return TRAIN_CONFIG_FILENAME, true
+}
+
+func LoadTrainConfig(filename string) (*TrainConfig, error) {
+	data, err := ioutil.ReadFile(filename)
+
+	if err != nil {
+		return nil, bettererrors.
+			New("Could not read train config").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("filename", filename)
+	}
+
+	var config TrainConfig
+
+	// Misspelled settings would be silently ignored otherwise
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, bettererrors.
+			New("Could not parse train config").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("filename", filename)
+	}
+
+	paths := make(map[string]bool)
+
+	for i, agent := range config.Agents {
+		if (agent.Image == "") == (agent.Path == "") {
+			return nil, bettererrors.
+				New("Each agent of the train config needs either an image or a path").
+				SetContext("filename", filename).
+				SetContext("agent", strconv.Itoa(i))
+		}
+
+		if agent.Image != "" && (len(agent.BuildArgs) > 0 || agent.NoCache) {
+			return nil, bettererrors.
+				New("Build settings only apply to agents given by path").
+				SetContext("filename", filename).
+				SetContext("agent", strconv.Itoa(i))
+		}
+
+		// Instances of an agent share their build; they are set with count
+		if agent.Path != "" {
+			if paths[filepath.Clean(agent.Path)] {
+				return nil, bettererrors.
+					New("Agent path listed twice in the train config; use count for several instances").
+					SetContext("filename", filename).
+					SetContext("path", agent.Path)
+			}
+
+			paths[filepath.Clean(agent.Path)] = true
+		}
+	}
+
+	config.dir = filepath.Dir(filename)
+
+	return &config, nil
+}
+
+// Apply sets the arguments which were not given explicitly, isSet telling
+// whether the flag of the given name was used.
+func (config *TrainConfig) Apply(args *TrainActionArguments, isSet func(name string) bool) {
+	applyInt(config.Tps, &args.Tps, isSet("tps"))
+	applyString(config.Host, &args.Host, isSet("host"))
+	applyString(config.MapName, &args.MapName, isSet("map"))
+	applyInt(config.DurationSeconds, &args.DurationSeconds, isSet("duration"))
+	applyString(config.path(config.RecordFile), &args.RecordFile, isSet("record-file"))
+	applyString(config.Viz.Host, &args.Vizhost, isSet("viz-host"))
+	applyInt(config.Viz.Port, &args.Vizport, isSet("port"))
+	applyBool(config.Viz.Nobrowser, &args.Nobrowser, isSet("no-browser"))
+	applyBool(config.IsDebug, &args.IsDebug, isSet("debug"))
+	applyBool(config.IsQuiet, &args.IsQuiet, isSet("quiet"))
+	applyBool(config.Headless, &args.Headless, isSet("headless"))
+	applyInt(config.Matches, &args.Matches, isSet("matches"))
+	applyString(config.path(config.ReportFile), &args.ReportFile, isSet("report"))
+	applyString(config.ReportFormat, &args.ReportFormat, isSet("report-format"))
+	applyString(config.Output, &args.Output, isSet("output"))
+	applyString(config.path(config.OutputFile), &args.OutputFile, isSet("output-file"))
+
+	if config.Seed != nil && !isSet("seed") {
+		args.Seed = *config.Seed
+		args.SeedSet = true
+	}
+
+	// Agents given on the command line replace the ones of the config
+	if isSet("agent") || isSet("watch") {
+		return
+	}
+
+	for _, agent := range config.Agents {
+		count := agent.Count
+		if count <= 0 {
+			count = 1
+		}
+
+		if agent.Path != "" && (len(agent.BuildArgs) > 0 || agent.NoCache) {
+			if args.WatchedAgentBuilds == nil {
+				args.WatchedAgentBuilds = make(map[string]build.Arguments)
+			}
+
+			args.WatchedAgentBuilds[*config.path(&agent.Path)] = build.Arguments{
+				BuildArgs: agent.BuildArgs,
+				NoCache:   agent.NoCache,
+			}
+		}
+
+		for i := 0; i < count; i++ {
+			if agent.Image != "" {
+				args.Agentimages = append(args.Agentimages, agent.Image)
+			} else {
+				args.WatchedAgentimages = append(args.WatchedAgentimages, *config.path(&agent.Path))
+			}
+		}
+	}
+}
+
+func (config *TrainConfig) path(p *string) *string {
+	if p == nil || *p == "" || filepath.IsAbs(*p) {
+		return p
+	}
+
+	joined := filepath.Join(config.dir, *p)
+
+	return &joined
+}
+
+func applyInt(value *int, arg *int, isSet bool) {
+	if value != nil && !isSet {
+		*arg = *value
+	}
+}
+
+func applyString(value *string, arg *string, isSet bool) {
+	if value != nil && !isSet {
+		*arg = *value
+	}
+}
+
+func applyBool(value *bool, arg *bool, isSet bool) {
+	if value != nil && !isSet {
+		*arg = *value
+	}
+}
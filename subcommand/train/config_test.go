@@ -0,0 +1,121 @@
+package train
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bytearena/ba/subcommand/build"
+)
+
+func intValue(v int) *int          { return &v }
+func stringValue(v string) *string { return &v }
+func boolValue(v bool) *bool       { return &v }
+
+func isSetFlags(names ...string) func(string) bool {
+	set := make(map[string]bool)
+	for _, name := range names {
+		set[name] = true
+	}
+
+	return func(name string) bool { return set[name] }
+}
+
+func TestApplySettings(t *testing.T) {
+	config := TrainConfig{
+		Tps:        intValue(20),
+		MapName:    stringValue("hexagon"),
+		RecordFile: stringValue("records/game.bin"),
+		IsQuiet:    boolValue(true),
+		Output:     stringValue(OUTPUT_JSON),
+		dir:        "/home/ba",
+	}
+
+	args := TrainActionArguments{Tps: 10, MapName: "deathmatch/desert/death-valley", IsQuiet: false}
+	config.Apply(&args, isSetFlags("map"))
+
+	if args.Tps != 20 {
+		t.Errorf("tps: expected 20 from the config, got %d", args.Tps)
+	}
+
+	if args.MapName != "deathmatch/desert/death-valley" {
+		t.Errorf("map: expected the flag to take precedence, got %s", args.MapName)
+	}
+
+	if args.RecordFile != "/home/ba/records/game.bin" {
+		t.Errorf("record file: expected a path relative to the config, got %s", args.RecordFile)
+	}
+
+	if !args.IsQuiet || args.Output != OUTPUT_JSON {
+		t.Errorf("expected quiet and json output from the config, got %v and %s", args.IsQuiet, args.Output)
+	}
+}
+
+func TestApplySeed(t *testing.T) {
+	var seed int64
+
+	tests := []struct {
+		isSet    func(string) bool
+		expected bool
+	}{
+		{isSet: isSetFlags(), expected: true},
+		{isSet: isSetFlags("seed"), expected: false},
+	}
+
+	for _, test := range tests {
+		config := TrainConfig{Seed: &seed}
+		args := TrainActionArguments{Seed: 42}
+
+		config.Apply(&args, test.isSet)
+
+		// A seed of 0 is a seed like any other
+		if args.SeedSet != test.expected || (test.expected && args.Seed != 0) {
+			t.Errorf("seed %d set %v: expected set %v", args.Seed, args.SeedSet, test.expected)
+		}
+	}
+}
+
+func TestApplyAgents(t *testing.T) {
+	config := TrainConfig{
+		Agents: []TrainConfigAgent{
+			{Image: "sample", Count: 2},
+			{Path: "agents/mine", Count: 3, BuildArgs: []string{"LEVEL=hard"}, NoCache: true},
+			{Path: "/agents/other"},
+		},
+		dir: "/home/ba",
+	}
+
+	args := TrainActionArguments{}
+	config.Apply(&args, isSetFlags())
+
+	if expected := []string{"sample", "sample"}; !reflect.DeepEqual(args.Agentimages, expected) {
+		t.Errorf("agents: expected %v, got %v", expected, args.Agentimages)
+	}
+
+	expectedWatched := []string{"/home/ba/agents/mine", "/home/ba/agents/mine", "/home/ba/agents/mine", "/agents/other"}
+	if !reflect.DeepEqual(args.WatchedAgentimages, expectedWatched) {
+		t.Errorf("watched agents: expected %v, got %v", expectedWatched, args.WatchedAgentimages)
+	}
+
+	expectedBuilds := map[string]build.Arguments{
+		"/home/ba/agents/mine": {BuildArgs: []string{"LEVEL=hard"}, NoCache: true},
+	}
+
+	if !reflect.DeepEqual(args.WatchedAgentBuilds, expectedBuilds) {
+		t.Errorf("builds: expected %v, got %v", expectedBuilds, args.WatchedAgentBuilds)
+	}
+}
+
+func TestApplyAgentsFromFlags(t *testing.T) {
+	config := TrainConfig{
+		Agents: []TrainConfigAgent{{Image: "sample"}},
+	}
+
+	for _, flag := range []string{"agent", "watch"} {
+		args := TrainActionArguments{Agentimages: []string{"mine"}}
+		config.Apply(&args, isSetFlags(flag))
+
+		if expected := []string{"mine"}; !reflect.DeepEqual(args.Agentimages, expected) {
+			t.Errorf("--%s: expected the agents of the flags only, got %v", flag, args.Agentimages)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package train
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	bettererrors "github.com/xtuc/better-errors"
+
+	"github.com/bytearena/core/arenaserver"
+	"github.com/bytearena/core/common/utils"
+)
+
+const (
+	OUTPUT_TEXT = "text"
+	OUTPUT_JSON = "json"
+)
+
+// EventLogger outputs the events of the trainer.
+type EventLogger interface {
+	Log(msg interface{})
+
+	// NextTick is called each time the game state is streamed
+	NextTick()
+
+	// NewMatch is called before each match of a batch; ticks are counted
+	// from the start of the match
+	NewMatch(number int)
+
+	Close() error
+}
+
+func NewEventLogger(args TrainActionArguments) (EventLogger, error) {
+	switch args.Output {
+	case OUTPUT_TEXT, "":
+		return &textEventLogger{args: args}, nil
+
+	case OUTPUT_JSON:
+		var out io.WriteCloser = os.Stdout
+
+		if args.OutputFile != "" {
+			file, err := os.Create(args.OutputFile)
+
+			if err != nil {
+				return nil, bettererrors.
+					New("Could not create output file").
+					With(bettererrors.NewFromErr(err)).
+					SetContext("filename", args.OutputFile)
+			}
+
+			out = file
+		}
+
+		return &jsonEventLogger{
+			args:    args,
+			out:     out,
+			encoder: json.NewEncoder(out),
+		}, nil
+	}
+
+	return nil, bettererrors.
+		New("Unsupported output").
+		SetContext("output", args.Output)
+}
+
+// textOutput is where the messages of the trainer that are not events go;
+// stdout holds the events with the json output.
+func textOutput(args TrainActionArguments) io.Writer {
+	if args.Output == OUTPUT_JSON {
+		return os.Stderr
+	}
+
+	return os.Stdout
+}
+
+// consumeEvents logs the server events until the server closes. Errors end
+// the game: they are sent on errs when it is given, so that only the match
+// fails, and exit the trainer otherwise.
+func consumeEvents(srv *arenaserver.Server, logger EventLogger, errs chan<- error) {
+	events := srv.Events()
+
+	for {
+		msg := <-events
+
+		if _, isClose := msg.(arenaserver.EventClose); isClose {
+			return
+		}
+
+		logger.Log(msg)
+
+		if t, isError := msg.(arenaserver.EventError); isError {
+			if errs == nil {
+				logger.Close()
+				utils.FailWith(t.Err)
+			}
+
+			select {
+			case errs <- t.Err:
+			default:
+			}
+		}
+	}
+}
+
+type textEventLogger struct {
+	args TrainActionArguments
+}
+
+func (l *textEventLogger) Log(msg interface{}) {
+	args := l.args
+
+	switch t := msg.(type) {
+	case arenaserver.EventStatusGameUpdate:
+		if !args.IsQuiet {
+			fmt.Printf(GameColor("[game] %s\n"), t.Status)
+		}
+
+	case arenaserver.EventAgentLog:
+		fmt.Printf(AgentColor("[agent] %s\n"), t.Value)
+
+	case arenaserver.EventLog:
+		if !args.IsQuiet {
+			fmt.Printf(LogColor("[log] %s\n"), t.Value)
+		}
+
+	case arenaserver.EventDebug:
+		if args.IsDebug {
+			fmt.Printf(DebugColor("[debug] %s\n"), t.Value)
+		}
+
+	case arenaserver.EventError:
+		// Reported by consumeEvents
+
+	case arenaserver.EventWarn:
+		utils.WarnWith(t.Err)
+
+	case arenaserver.EventHeadsUp:
+		fmt.Printf(HeadsUpColor("[headsup] %s\n"), t.Value)
+
+	case arenaserver.EventRawComm:
+		if args.IsDebug {
+			fmt.Printf(DebugColor("[debug from: %s] %s\n"), t.From, t.Value)
+		}
+
+	default:
+		msg := fmt.Sprintf("Unsupported message of type %s", reflect.TypeOf(msg))
+		panic(msg)
+	}
+}
+
+func (l *textEventLogger) NextTick() {}
+
+func (l *textEventLogger) NewMatch(number int) {}
+
+func (l *textEventLogger) Close() error {
+	return nil
+}
+
+// jsonEventLogger outputs one JSON object per event and per line.
+type jsonEventLogger struct {
+	args    TrainActionArguments
+	mutex   sync.Mutex
+	out     io.WriteCloser
+	encoder *json.Encoder
+	match   int
+	tick    int
+}
+
+type jsonEvent struct {
+	Type      string      `json:"type"`
+	Timestamp string      `json:"timestamp"`
+	Match     int         `json:"match,omitempty"`
+	Tick      int         `json:"tick"`
+	Agent     string      `json:"agent,omitempty"`
+	Payload   interface{} `json:"payload"`
+}
+
+func (l *jsonEventLogger) Log(msg interface{}) {
+	args := l.args
+	event := jsonEvent{}
+
+	switch t := msg.(type) {
+	case arenaserver.EventStatusGameUpdate:
+		if args.IsQuiet {
+			return
+		}
+
+		event.Type = "game"
+		event.Payload = t.Status
+
+	case arenaserver.EventAgentLog:
+		event.Type = "agent"
+		event.Agent = t.AgentName
+		event.Payload = t.Value
+
+	case arenaserver.EventLog:
+		if args.IsQuiet {
+			return
+		}
+
+		event.Type = "log"
+		event.Payload = t.Value
+
+	case arenaserver.EventDebug:
+		if !args.IsDebug {
+			return
+		}
+
+		event.Type = "debug"
+		event.Payload = t.Value
+
+	case arenaserver.EventError:
+		event.Type = "error"
+		event.Payload = t.Err.Error()
+
+	case arenaserver.EventWarn:
+		event.Type = "warn"
+		event.Payload = t.Err.Error()
+
+	case arenaserver.EventHeadsUp:
+		event.Type = "headsup"
+		event.Payload = t.Value
+
+	case arenaserver.EventRawComm:
+		if !args.IsDebug {
+			return
+		}
+
+		event.Type = "rawcomm"
+		event.Agent = t.From
+		event.Payload = t.Value
+
+	default:
+		event.Type = reflect.TypeOf(msg).String()
+		event.Payload = msg
+	}
+
+	l.mutex.Lock()
+	event.Timestamp = time.Now().Format(time.RFC3339Nano)
+	event.Match = l.match
+	event.Tick = l.tick
+	l.encoder.Encode(event)
+	l.mutex.Unlock()
+}
+
+func (l *jsonEventLogger) NextTick() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.tick++
+}
+
+func (l *jsonEventLogger) NewMatch(number int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.match = number
+	l.tick = 0
+}
+
+func (l *jsonEventLogger) Close() error {
+	if l.out == os.Stdout {
+		return nil
+	}
+
+	return l.out.Close()
+}
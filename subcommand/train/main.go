@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"reflect"
 	"runtime/pprof"
 	"strconv"
 	"time"
@@ -18,16 +17,13 @@ import (
 	"github.com/skratchdot/open-golang/open"
 
 	"github.com/bytearena/core/arenaserver"
-	"github.com/bytearena/core/arenaserver/container"
 	"github.com/bytearena/core/common"
-	"github.com/bytearena/core/common/mappack"
 	"github.com/bytearena/core/common/mq"
 	"github.com/bytearena/core/common/recording"
 	"github.com/bytearena/core/common/types"
 	"github.com/bytearena/core/common/utils"
 	"github.com/bytearena/core/common/visualization"
 	viztypes "github.com/bytearena/core/common/visualization/types"
-	"github.com/bytearena/core/game/deathmatch"
 
 	"github.com/bytearena/ba/subcommand/build"
 	mapcmd "github.com/bytearena/ba/subcommand/map"
@@ -62,11 +58,20 @@ type TrainActionArguments struct {
 	RecordFile         string
 	Agentimages        []string
 	WatchedAgentimages []string
+	WatchedAgentBuilds map[string]build.Arguments
 	IsDebug            bool
 	IsQuiet            bool
 	MapName            string
 	ShouldProfile      bool
 	DurationSeconds    int
+	Headless           bool
+	Matches            int
+	ReportFile         string
+	ReportFormat       string
+	Seed               int64
+	SeedSet            bool
+	Output             string
+	OutputFile         string
 }
 
 func TrainAction(args TrainActionArguments) (bool, error) {
@@ -88,14 +93,7 @@ func TrainAction(args TrainActionArguments) (bool, error) {
 		gameDuration = &d
 	}
 
-	shutdownChan := make(chan bool)
-	debug := func(str string) {}
-
-	if args.IsDebug {
-		debug = func(str string) {
-			fmt.Printf(DebugColor("[debug] %s\n"), str)
-		}
-	}
+	shutdownChan := make(chan bool, 1)
 
 	if args.Host == "" {
 		ip, err := utils.GetCurrentIP()
@@ -107,98 +105,126 @@ func TrainAction(args TrainActionArguments) (bool, error) {
 		return SHOW_USAGE, bettererrors.New("No agents were specified")
 	}
 
-	runPreflightChecks()
+	if args.Matches <= 0 {
+		args.Matches = 1
+	}
+
+	if args.Matches > 1 && !args.Headless {
+		return SHOW_USAGE, bettererrors.New("Running several matches requires the `--headless` flag")
+	}
 
-	// Make message broker client
-	brokerclient, err := NewMemoryMessageClient()
-	utils.Check(err, "ERROR: Could not connect to messagebroker")
+	if args.Headless && gameDuration == nil {
+		return SHOW_USAGE, bettererrors.New("Headless matches require a `--duration`")
+	}
 
-	mappack, errMappack := mappack.UnzipAndGetHandles(mapcmd.GetMapLocation(args.MapName))
-	if errMappack != nil {
-		utils.FailWith(errMappack)
+	if args.Headless {
+		if _, err := getReportFormat(args.ReportFile, args.ReportFormat); err != nil {
+			return SHOW_USAGE, err
+		}
 	}
 
-	gamedescription, err := NewMockGame(args.Tps, mappack)
+	if args.Headless && args.Output == OUTPUT_JSON && args.OutputFile == "" && args.ReportFile == "" {
+		return SHOW_USAGE, bettererrors.New("The events and the report can't both be written to stdout; specify `--output-file` or `--report`")
+	}
+
+	logger, err := NewEventLogger(args)
 	if err != nil {
-		utils.FailWith(err)
+		return SHOW_USAGE, err
 	}
 
-	game := deathmatch.NewDeathmatchGame(gamedescription)
+	defer logger.Close()
 
-	orchestrator := container.MakeLocalContainerOrchestrator(args.Host)
+	debug := func(str string) {
+		logger.Log(arenaserver.EventDebug{Value: str})
+	}
 
-	arenaServerUUID := ""
+	RunPreflightChecks()
 
-	srv := arenaserver.NewServer(
-		args.Host,
-		orchestrator,
-		gamedescription,
-		game,
-		arenaServerUUID,
-		brokerclient,
-		gameDuration,
-		args.IsDebug,
-	)
+	// Watched agents are built for the first time before the game starts;
+	// instances of the same agent share their build
+	watchedDockerImageNames := make([]string, 0)
+	builtDockerImageNames := make(map[string]string)
 
-	// Regular agents
-	for _, dockerImageName := range args.Agentimages {
-		agentManifest, err := types.GetAgentManifestByDockerImageName(dockerImageName, orchestrator)
-		if err != nil {
-			return DONT_SHOW_USAGE, err
+	for _, agentPath := range args.WatchedAgentimages {
+		dockerImageName, built := builtDockerImageNames[agentPath]
+
+		if !built {
+			dockerImageName, err = buildWatchedAgent(agentPath, args)
+			if err != nil {
+				return DONT_SHOW_USAGE, err
+			}
+
+			builtDockerImageNames[agentPath] = dockerImageName
 		}
 
-		agent := &types.Agent{Manifest: agentManifest}
+		watchedDockerImageNames = append(watchedDockerImageNames, dockerImageName)
+	}
+
+	dockerImageNames := append(append([]string{}, args.Agentimages...), watchedDockerImageNames...)
+
+	go func() {
+		utils.LogFn = func(service, message string) {
+			if args.Output == OUTPUT_JSON {
+				logger.Log(arenaserver.EventLog{Value: message})
+			} else {
+				fmt.Println(message)
+			}
+		}
+	}()
+
+	// handling signals
+	go func() {
+		<-common.SignalHandler()
+		shutdownChan <- true
+	}()
 
-		gamedescription.AddAgent(agent)
-		srv.RegisterAgent(agent, nil)
+	if args.Headless {
+		return DONT_SHOW_USAGE, trainBatch(args, gameDuration, dockerImageNames, shutdownChan, logger)
 	}
 
-	// Watched agents
-	for _, agentPath := range args.WatchedAgentimages {
+	m, err := newMatch(args, gameDuration, dockerImageNames)
+	if err != nil {
+		return DONT_SHOW_USAGE, err
+	}
 
-		// build for the first time
-		_, buildErr := build.Main(agentPath, build.Arguments{})
+	srv := m.srv
+	gamedescription := m.gamedescription
 
-		if buildErr != nil {
-			berror := bettererrors.
-				New("Failed to build agent").
-				With(buildErr)
+	// Watched agents are registered after the regular ones; each path is
+	// watched once and reloads all its instances
+	watchedPaths := make([]string, 0)
+	watchedAgents := make(map[string][]*types.Agent)
 
-			utils.FailWith(berror)
+	for i, agentPath := range args.WatchedAgentimages {
+		if _, seen := watchedAgents[agentPath]; !seen {
+			watchedPaths = append(watchedPaths, agentPath)
 		}
 
+		watchedAgents[agentPath] = append(watchedAgents[agentPath], m.agents[len(args.Agentimages)+i])
+	}
+
+	for _, agentPath := range watchedPaths {
+		agentPath := agentPath
+		agents := watchedAgents[agentPath]
+
 		watcher, watcherr := watcher.MakeWatcher()
 
 		if watcherr != nil {
-			return DONT_SHOW_USAGE, bettererrors.NewFromErr(err)
+			return DONT_SHOW_USAGE, bettererrors.NewFromErr(watcherr)
 		}
 
-		// Get image name from agent manifest file
-		agentManifest, parseManifestError := types.ParseAgentManifestFromDir(agentPath)
+		if watcherr := watcher.Add(agentPath); watcherr != nil {
+			watcher.Close()
 
-		if parseManifestError != nil {
 			return DONT_SHOW_USAGE, bettererrors.
-				New("Could not parse manifest").
-				With(parseManifestError)
+				New("Could not watch agent directory").
+				With(watcherr).
+				SetContext("directory", agentPath)
 		}
 
-		dockerImageName := agentManifest.Id
-
-		agentManifest, err := types.GetAgentManifestByDockerImageName(dockerImageName, orchestrator)
-		if err != nil {
-			return DONT_SHOW_USAGE, err
-		}
-
-		agent := &types.Agent{Manifest: agentManifest}
-
-		gamedescription.AddAgent(agent)
-		srv.RegisterAgent(agent, nil)
-
 		go func() {
 			defer watcher.Close()
 
-			watcher.Add(agentPath)
-
 			for {
 				watcherErr := <-watcher.Wait()
 
@@ -207,104 +233,57 @@ func TrainAction(args TrainActionArguments) (bool, error) {
 					return
 				}
 
-				_, buildErr := build.Main(agentPath, build.Arguments{})
+				// The build lints the Dockerfile; the running agent is kept
+				// until the agent is fixed
+				_, buildErr := build.Main(agentPath, buildArguments(args, agentPath))
 
 				if buildErr != nil {
-					berror := bettererrors.
+					utils.WarnWith(bettererrors.
 						New("Failed to build agent").
-						With(buildErr)
+						With(buildErr))
 
-					utils.FailWith(berror)
+					fmt.Fprintf(textOutput(args), "The agent was not reloaded; awaiting changes in %s ...\n", agentPath)
+					continue
 				}
 
-				fmt.Printf("Awaiting changes in %s ...\n", agentPath)
+				fmt.Fprintf(textOutput(args), "Awaiting changes in %s ...\n", agentPath)
 
-				reloadErr := srv.ReloadAgent(agent)
+				for _, agent := range agents {
+					reloadErr := srv.ReloadAgent(agent)
 
-				if reloadErr != nil {
-					berror := bettererrors.
-						New("Could not reload agent").
-						With(reloadErr)
+					if reloadErr != nil {
+						berror := bettererrors.
+							New("Could not reload agent").
+							With(reloadErr)
 
-					utils.FailWith(berror)
-					return
+						utils.FailWith(berror)
+						return
+					}
 				}
 			}
 		}()
 	}
 
 	// consume server events
-	go func() {
-		events := srv.Events()
-
-		for {
-			msg := <-events
-
-			switch t := msg.(type) {
-			case arenaserver.EventStatusGameUpdate:
-				if !args.IsQuiet {
-					fmt.Printf(GameColor("[game] %s\n"), t.Status)
-				}
-
-			case arenaserver.EventAgentLog:
-				fmt.Printf(AgentColor("[agent] %s\n"), t.Value)
+	go consumeEvents(srv, logger, nil)
 
-			case arenaserver.EventLog:
-				if !args.IsQuiet {
-					fmt.Printf(LogColor("[log] %s\n"), t.Value)
-				}
-
-			case arenaserver.EventDebug:
-				debug(t.Value)
-
-			case arenaserver.EventError:
-				utils.FailWith(t.Err)
-
-			case arenaserver.EventWarn:
-				utils.WarnWith(t.Err)
-
-			case arenaserver.EventHeadsUp:
-				fmt.Printf(HeadsUpColor("[headsup] %s\n"), t.Value)
-
-			case arenaserver.EventRawComm:
-				if args.IsDebug {
-					fmt.Printf(DebugColor("[debug from: %s] %s\n"), t.From, t.Value)
-				}
-
-			case arenaserver.EventClose:
-				return
-
-			default:
-				msg := fmt.Sprintf("Unsupported message of type %s", reflect.TypeOf(msg))
-				panic(msg)
-			}
-		}
-	}()
-
-	go func() {
-		utils.LogFn = func(service, message string) {
-			fmt.Println(message)
-		}
-	}()
-
-	// handling signals
-	go func() {
-		<-common.SignalHandler()
-		shutdownChan <- true
-	}()
-
-	go common.StreamState(srv, brokerclient, "trainer")
+	go common.StreamState(srv, m.brokerclient, "trainer")
 
 	var recorder recording.RecorderInterface = recording.MakeEmptyRecorder()
 	if args.RecordFile != "" {
-		recorder = recording.MakeSingleArenaRecorder(args.RecordFile)
+		recorder, err = newRecorder(args.RecordFile, m, args)
+		if err != nil {
+			return DONT_SHOW_USAGE, err
+		}
 	}
 
 	recorder.RecordMetadata(gamedescription.GetId(), gamedescription.GetMapContainer())
 
-	brokerclient.Subscribe("viz", "message", func(msg mq.BrokerMessage) {
+	m.brokerclient.Subscribe("viz", "message", func(msg mq.BrokerMessage) {
 		gameID := gamedescription.GetId()
 
+		logger.NextTick()
+
 		recorder.Record(gameID, string(msg.Data))
 		notify.PostTimeout("viz:message:"+gameID, string(msg.Data), time.Millisecond)
 	})
@@ -312,14 +291,14 @@ func TrainAction(args TrainActionArguments) (bool, error) {
 	// TODO(jerome): refac webclient path / serving
 
 	vizgames := make([]*viztypes.VizGame, 1)
-	vizgames[0] = viztypes.NewVizGame(game, gamedescription)
+	vizgames[0] = viztypes.NewVizGame(m.game, gamedescription)
 
 	vizservice := visualization.NewVizService(
 		args.Vizhost+":"+strconv.Itoa(args.Vizport),
-		args.MapName,
+		m.mapName,
 		func() ([]*viztypes.VizGame, error) { return vizgames, nil },
 		recorder,
-		mappack,
+		m.mappack,
 	)
 
 	vizservice.Start()
@@ -337,6 +316,17 @@ func TrainAction(args TrainActionArguments) (bool, error) {
 	}
 
 	srv.Log(arenaserver.EventHeadsUp{"Game running at " + url})
+	srv.Log(arenaserver.EventHeadsUp{"Game seed is " + strconv.FormatInt(m.seed, 10) + " (--seed)"})
+
+	if mapcmd.IsMapPath(args.MapName) {
+		watchErr := watchLocalMap(args.MapName, func(message string) {
+			srv.Log(arenaserver.EventHeadsUp{Value: message})
+		})
+
+		if watchErr != nil {
+			utils.WarnWith(watchErr)
+		}
+	}
 
 	// Wait until someone asks for shutdown
 	select {
@@ -364,3 +354,77 @@ func TrainAction(args TrainActionArguments) (bool, error) {
 
 	return DONT_SHOW_USAGE, nil
 }
+
+// watchLocalMap tells when a local map directory changes during the game;
+// the map is loaded when the game starts, so its changes are only played
+// once ba train is restarted. Batch matches load it again each time.
+func watchLocalMap(mapPath string, log func(message string)) error {
+	info, err := os.Stat(mapPath)
+
+	if err != nil || !info.IsDir() {
+		return nil
+	}
+
+	mapWatcher, err := watcher.MakeWatcher()
+
+	if err != nil {
+		return err
+	}
+
+	if err := mapWatcher.Add(mapPath); err != nil {
+		mapWatcher.Close()
+
+		return bettererrors.
+			New("Could not watch map directory").
+			With(err).
+			SetContext("directory", mapPath)
+	}
+
+	log("The map is loaded once; restart ba train to play on the changes made to " + mapPath)
+
+	go func() {
+		defer mapWatcher.Close()
+
+		for {
+			if err := <-mapWatcher.Wait(); err != nil {
+				return
+			}
+
+			log("The map in " + mapPath + " has changed; restart ba train to play on it")
+		}
+	}()
+
+	return nil
+}
+
+// buildWatchedAgent builds the agent in the given directory and returns the
+// name of its Docker image.
+func buildWatchedAgent(agentPath string, args TrainActionArguments) (string, error) {
+	_, buildErr := build.Main(agentPath, buildArguments(args, agentPath))
+
+	if buildErr != nil {
+		return "", bettererrors.
+			New("Failed to build agent").
+			With(buildErr)
+	}
+
+	// Get image name from agent manifest file
+	agentManifest, parseManifestError := types.ParseAgentManifestFromDir(agentPath)
+
+	if parseManifestError != nil {
+		return "", bettererrors.
+			New("Could not parse manifest").
+			With(parseManifestError)
+	}
+
+	return agentManifest.Id, nil
+}
+
+// buildArguments returns the build settings of a watched agent, keeping the
+// logs of its builds out of the JSON events.
+func buildArguments(args TrainActionArguments, agentPath string) build.Arguments {
+	arguments := args.WatchedAgentBuilds[agentPath]
+	arguments.Stderr = args.Output == OUTPUT_JSON
+
+	return arguments
+}
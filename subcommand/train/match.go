@@ -0,0 +1,151 @@
+package train
+
+import (
+	"math/rand"
+	"time"
+
+	bettererrors "github.com/xtuc/better-errors"
+
+	"github.com/bytearena/core/arenaserver"
+	"github.com/bytearena/core/arenaserver/container"
+	"github.com/bytearena/core/common/mappack"
+	"github.com/bytearena/core/common/types"
+	"github.com/bytearena/core/common/types/mapcontainer"
+	"github.com/bytearena/core/game/deathmatch"
+
+	mapcmd "github.com/bytearena/ba/subcommand/map"
+)
+
+// match is a single deathmatch game with its agents registered, ready to be
+// started.
+type match struct {
+	brokerclient    *MemoryMessageClient
+	mappack         *mappack.MappackInMemoryArchive
+	gamedescription *MockGame
+	game            *deathmatch.DeathmatchGame
+	srv             *arenaserver.Server
+	agents          []*types.Agent
+	images          []string
+	seed            int64
+	mapName         string
+	mapChecksum     string
+}
+
+func newMatch(args TrainActionArguments, gameDuration *time.Duration, dockerImageNames []string) (*match, error) {
+
+	seed := args.Seed
+	if !args.SeedSet {
+		seed = time.Now().UnixNano()
+	}
+
+	// The match draws spawn points and seats from its own source, which
+	// concurrent matches can't advance. The game itself draws from the
+	// global source; cmd/ba keeps rand.Seed effective on Go 1.24 and later
+	rng := rand.New(rand.NewSource(seed))
+	rand.Seed(seed)
+
+	// Make message broker client
+	brokerclient, err := NewMemoryMessageClient()
+	if err != nil {
+		return nil, bettererrors.
+			New("Could not connect to messagebroker").
+			With(err)
+	}
+
+	mapLocation, releaseMapLocation, err := mapcmd.ResolveMapLocation(args.MapName)
+	if err != nil {
+		return nil, err
+	}
+
+	// The map pack is loaded in memory; zipped map directories are not kept
+	defer releaseMapLocation()
+
+	mapChecksum, err := mapcmd.GetMapChecksum(args.MapName, mapLocation)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only used to prune unused maps; not worth failing the match for
+	mapcmd.RecordMapUsage(args.MapName)
+
+	mappack, errMappack := mappack.UnzipAndGetHandles(mapLocation)
+	if errMappack != nil {
+		return nil, errMappack
+	}
+
+	gamedescription, err := NewMockGame(args.Tps, getMatchLaunchedAt(seed), mappack)
+	if err != nil {
+		return nil, err
+	}
+
+	seats := seatMatch(rng, gamedescription.GetMapContainer(), len(dockerImageNames))
+
+	game := deathmatch.NewDeathmatchGame(gamedescription)
+
+	orchestrator := container.MakeLocalContainerOrchestrator(args.Host)
+
+	arenaServerUUID := ""
+
+	srv := arenaserver.NewServer(
+		args.Host,
+		orchestrator,
+		gamedescription,
+		game,
+		arenaServerUUID,
+		brokerclient,
+		gameDuration,
+		args.IsDebug,
+	)
+
+	// Agents are kept in the given order, and registered in the one of
+	// their seats
+	agents := make([]*types.Agent, 0)
+
+	for _, dockerImageName := range dockerImageNames {
+		agentManifest, err := types.GetAgentManifestByDockerImageName(dockerImageName, orchestrator)
+		if err != nil {
+			return nil, err
+		}
+
+		agents = append(agents, &types.Agent{Manifest: agentManifest})
+	}
+
+	for _, i := range seats {
+		gamedescription.AddAgent(agents[i])
+		srv.RegisterAgent(agents[i], nil)
+	}
+
+	return &match{
+		brokerclient:    brokerclient,
+		mappack:         mappack,
+		gamedescription: gamedescription,
+		game:            game,
+		srv:             srv,
+		agents:          agents,
+		images:          dockerImageNames,
+		seed:            seed,
+		mapName:         mapcmd.GetMapName(args.MapName),
+		mapChecksum:     mapChecksum,
+	}, nil
+}
+
+// getMatchLaunchedAt derives the launch time of a match from its seed, as the
+// game may depend on it; unseeded matches get the current time.
+func getMatchLaunchedAt(seed int64) time.Time {
+	return time.Unix(0, seed).UTC()
+}
+
+// seatMatch shuffles the spawn points of the map and returns the order in
+// which the agents are registered, both drawn from rng.
+func seatMatch(rng *rand.Rand, mapContainer *mapcontainer.MapContainer, agents int) []int {
+	starts := mapContainer.Data.Starts
+	shuffled := make([]mapcontainer.MapStart, len(starts))
+
+	for i, j := range rng.Perm(len(starts)) {
+		shuffled[i] = starts[j]
+	}
+
+	mapContainer.Data.Starts = shuffled
+
+	return rng.Perm(agents)
+}
@@ -0,0 +1,47 @@
+package train
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/bytearena/core/common/types/mapcontainer"
+)
+
+func newTestMap(starts int) *mapcontainer.MapContainer {
+	mapContainer := &mapcontainer.MapContainer{}
+
+	for i := 0; i < starts; i++ {
+		mapContainer.Data.Starts = append(mapContainer.Data.Starts, mapcontainer.MapStart{Id: i})
+	}
+
+	return mapContainer
+}
+
+// seededMatch sets a match up as newMatch does, from seed alone.
+func seededMatch(seed int64) ([]mapcontainer.MapStart, []int, string) {
+	mapContainer := newTestMap(8)
+	seats := seatMatch(rand.New(rand.NewSource(seed)), mapContainer, 4)
+	game := MockGame{launchedAt: getMatchLaunchedAt(seed)}
+
+	return mapContainer.Data.Starts, seats, game.GetLaunchedAt()
+}
+
+func TestSeatMatch(t *testing.T) {
+	startsA, seatsA, launchedAtA := seededMatch(42)
+	startsB, seatsB, launchedAtB := seededMatch(42)
+
+	if !reflect.DeepEqual(startsA, startsB) || !reflect.DeepEqual(seatsA, seatsB) || launchedAtA != launchedAtB {
+		t.Errorf("expected the same match for the same seed, got %v %v %s and %v %v %s", startsA, seatsA, launchedAtA, startsB, seatsB, launchedAtB)
+	}
+
+	startsC, seatsC, _ := seededMatch(43)
+
+	if reflect.DeepEqual(startsA, startsC) && reflect.DeepEqual(seatsA, seatsC) {
+		t.Errorf("expected another seed to draw other spawn points or seats")
+	}
+
+	if len(startsA) != 8 || len(seatsA) != 4 {
+		t.Errorf("expected every spawn point and seat to be kept, got %v and %v", startsA, seatsA)
+	}
+}
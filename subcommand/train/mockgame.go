@@ -13,11 +13,12 @@ import (
 
 type MockGame struct {
 	tps          int
+	launchedAt   time.Time
 	agents       []*types.Agent
 	mapContainer *mapcontainer.MapContainer
 }
 
-func NewMockGame(tps int, mapbundle *mappack.MappackInMemoryArchive) (*MockGame, error) {
+func NewMockGame(tps int, launchedAt time.Time, mapbundle *mappack.MappackInMemoryArchive) (*MockGame, error) {
 
 	jsonsource, err := mapbundle.Open("map.json")
 	if err != nil {
@@ -30,12 +31,13 @@ func NewMockGame(tps int, mapbundle *mappack.MappackInMemoryArchive) (*MockGame,
 	if err := json.Unmarshal(jsonsource, &mapContainer); err != nil {
 
 		return nil, bettererrors.
-			New("map.json exists inside the map bundle, but is not valid.").
+			New("map.json exists inside the map bundle, but is not valid; run `ba map validate` for details.").
 			With(bettererrors.NewFromErr(err))
 	}
 
 	return &MockGame{
 		tps:          tps,
+		launchedAt:   launchedAt,
 		agents:       make([]*types.Agent, 0),
 		mapContainer: &mapContainer,
 	}, nil
@@ -58,7 +60,7 @@ func (game *MockGame) GetRunStatus() int {
 }
 
 func (game *MockGame) GetLaunchedAt() string {
-	return time.Now().Format("2006-01-02T15:04:05-0700")
+	return game.launchedAt.Format("2006-01-02T15:04:05-0700")
 }
 
 func (game *MockGame) GetEndedAt() string {
@@ -7,7 +7,7 @@ import (
 	bettererrors "github.com/xtuc/better-errors"
 )
 
-func runPreflightChecks() {
+func RunPreflightChecks() {
 	ensureDockerIsAvailable()
 }
 
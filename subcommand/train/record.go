@@ -0,0 +1,158 @@
+package train
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	bettererrors "github.com/xtuc/better-errors"
+
+	"github.com/bytearena/core/common/recording"
+)
+
+const (
+	// The metadata of a record is written next to it, the record itself
+	// being the one of core
+	RECORD_METADATA_SUFFIX = ".meta.json"
+
+	// Name of the entry holding the frames in a record archive
+	RECORD_ARCHIVE_FRAMES_ENTRY = "record"
+
+	// Frames are whole visualization messages, which can be large
+	RECORD_MAX_FRAME_SIZE = 16 * 1024 * 1024
+)
+
+// RecordMetadata describes how a recorded game was set up, so that it can be
+// replayed or run again identically.
+type RecordMetadata struct {
+	Seed       int64    `json:"seed"`
+	MapName    string   `json:"map"`
+	Tps        int      `json:"tps"`
+	Agents     []string `json:"agents"`
+	LaunchedAt string   `json:"launchedAt"`
+}
+
+func GetRecordMetadataLocation(recordFile string) string {
+	return recordFile + RECORD_METADATA_SUFFIX
+}
+
+// newRecorder writes the metadata of the match next to recordFile, and
+// returns the recorder of core.
+func newRecorder(recordFile string, m *match, args TrainActionArguments) (recording.RecorderInterface, error) {
+	data, _ := json.MarshalIndent(RecordMetadata{
+		Seed:       m.seed,
+		MapName:    args.MapName,
+		Tps:        args.Tps,
+		Agents:     m.images,
+		LaunchedAt: m.gamedescription.GetLaunchedAt(),
+	}, "", "    ")
+
+	filename := GetRecordMetadataLocation(recordFile)
+
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		return nil, bettererrors.
+			New("Could not write record metadata").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("filename", filename)
+	}
+
+	return recording.MakeSingleArenaRecorder(recordFile), nil
+}
+
+// ReadRecordMetadata reads the metadata written next to a record file.
+func ReadRecordMetadata(recordFile string) (RecordMetadata, error) {
+	var metadata RecordMetadata
+
+	filename := GetRecordMetadataLocation(recordFile)
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return metadata, bettererrors.
+			New("Could not read record metadata").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("filename", filename)
+	}
+
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return metadata, bettererrors.
+			New("Could not parse record metadata").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("filename", filename)
+	}
+
+	return metadata, nil
+}
+
+// ReadRecordFrames returns the visualization messages of a record file, one
+// per tick. Records of core are archives holding them in a "record" entry;
+// plain lists of messages are read as well.
+func ReadRecordFrames(recordFile string) ([]string, error) {
+	archive, err := zip.OpenReader(recordFile)
+
+	if err != nil {
+		file, openErr := os.Open(recordFile)
+
+		if openErr != nil {
+			return nil, bettererrors.
+				New("Could not open record file").
+				With(bettererrors.NewFromErr(openErr)).
+				SetContext("filename", recordFile)
+		}
+
+		defer file.Close()
+
+		return scanRecordFrames(file, recordFile)
+	}
+
+	defer archive.Close()
+
+	for _, entry := range archive.File {
+		if path.Clean(entry.Name) != RECORD_ARCHIVE_FRAMES_ENTRY {
+			continue
+		}
+
+		reader, err := entry.Open()
+
+		if err != nil {
+			return nil, bettererrors.
+				New("Could not open record archive").
+				With(bettererrors.NewFromErr(err)).
+				SetContext("filename", recordFile)
+		}
+
+		defer reader.Close()
+
+		return scanRecordFrames(reader, recordFile)
+	}
+
+	return nil, bettererrors.
+		New("Record archive contains no frames; was it written by `ba train --record-file`?").
+		SetContext("filename", recordFile).
+		SetContext("entry", RECORD_ARCHIVE_FRAMES_ENTRY)
+}
+
+func scanRecordFrames(reader io.Reader, recordFile string) ([]string, error) {
+	frames := make([]string, 0)
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), RECORD_MAX_FRAME_SIZE)
+
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			frames = append(frames, line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, bettererrors.
+			New("Could not read record file").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("filename", recordFile)
+	}
+
+	return frames, nil
+}
@@ -0,0 +1,131 @@
+package train
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecordMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ba-record-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	recordFile := filepath.Join(dir, "game.bin")
+
+	m := &match{
+		seed:            42,
+		images:          []string{"seeker:v1", "runner"},
+		gamedescription: &MockGame{launchedAt: time.Unix(0, 42).UTC()},
+	}
+
+	if _, err := newRecorder(recordFile, m, TrainActionArguments{MapName: "hexagon", Tps: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	metadata, err := ReadRecordMetadata(recordFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := RecordMetadata{
+		Seed:       42,
+		MapName:    "hexagon",
+		Tps:        10,
+		Agents:     []string{"seeker:v1", "runner"},
+		LaunchedAt: m.gamedescription.GetLaunchedAt(),
+	}
+
+	if !reflect.DeepEqual(metadata, expected) {
+		t.Errorf("expected %v, got %v", expected, metadata)
+	}
+}
+
+func TestReadRecordFrames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ba-record-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	writeArchive := func(name string, entries map[string]string) string {
+		filename := filepath.Join(dir, name)
+
+		file, err := os.Create(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		archive := zip.NewWriter(file)
+
+		for entry, content := range entries {
+			w, _ := archive.Create(entry)
+			w.Write([]byte(content))
+		}
+
+		archive.Close()
+		file.Close()
+
+		return filename
+	}
+
+	plain := filepath.Join(dir, "plain.bin")
+	ioutil.WriteFile(plain, []byte("{\"tick\": 1}\n\n{\"tick\": 2}\n"), 0644)
+
+	tests := []struct {
+		name       string
+		recordFile string
+		expected   []string
+		isError    bool
+	}{
+		{
+			name:       "core archive",
+			recordFile: writeArchive("core.bin", map[string]string{"record": "{\"tick\": 1}\n{\"tick\": 2}\n"}),
+			expected:   []string{`{"tick": 1}`, `{"tick": 2}`},
+		},
+		{
+			name:       "plain messages",
+			recordFile: plain,
+			expected:   []string{`{"tick": 1}`, `{"tick": 2}`},
+		},
+		{
+			name:       "archive without frames",
+			recordFile: writeArchive("other.zip", map[string]string{"map.json": "{}"}),
+			isError:    true,
+		},
+		{
+			name:       "missing file",
+			recordFile: filepath.Join(dir, "missing.bin"),
+			isError:    true,
+		},
+	}
+
+	for _, test := range tests {
+		frames, err := ReadRecordFrames(test.recordFile)
+
+		if test.isError {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", test.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(frames, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, frames)
+		}
+	}
+}
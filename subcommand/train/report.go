@@ -0,0 +1,151 @@
+package train
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	bettererrors "github.com/xtuc/better-errors"
+)
+
+const (
+	REPORT_FORMAT_JSON = "json"
+	REPORT_FORMAT_CSV  = "csv"
+)
+
+type AgentResult struct {
+	Agent           string  `json:"agent"`
+	Id              string  `json:"id"`
+	Name            string  `json:"name"`
+	Kills           int     `json:"kills"`
+	Deaths          int     `json:"deaths"`
+	Score           int     `json:"score"`
+	SurvivalSeconds float64 `json:"survivalSeconds"`
+}
+
+type MatchResult struct {
+	Match           int           `json:"match"`
+	MapName         string        `json:"map"`
+	MapChecksum     string        `json:"mapChecksum"`
+	Seed            int64         `json:"seed"`
+	StartedAt       string        `json:"startedAt"`
+	DurationSeconds float64       `json:"durationSeconds"`
+	Interrupted     bool          `json:"interrupted,omitempty"`
+	Error           string        `json:"error,omitempty"`
+	Agents          []AgentResult `json:"agents"`
+}
+
+// getReportFormat returns the requested format, or guesses it from the
+// extension of the report file.
+func getReportFormat(filename, format string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(filename), ".")
+	}
+
+	switch strings.ToLower(format) {
+	case REPORT_FORMAT_CSV:
+		return REPORT_FORMAT_CSV, nil
+	case REPORT_FORMAT_JSON, "":
+		return REPORT_FORMAT_JSON, nil
+	}
+
+	return "", bettererrors.
+		New("Unsupported report format").
+		SetContext("format", format)
+}
+
+func writeReport(filename, format string, results []MatchResult) error {
+	format, err := getReportFormat(filename, format)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+
+	if filename != "" {
+		file, err := os.Create(filename)
+
+		if err != nil {
+			return bettererrors.
+				New("Could not create report file").
+				With(bettererrors.NewFromErr(err)).
+				SetContext("filename", filename)
+		}
+
+		defer file.Close()
+		out = file
+	}
+
+	switch format {
+	case REPORT_FORMAT_CSV:
+		err = writeCSVReport(out, results)
+	default:
+		err = writeJSONReport(out, results)
+	}
+
+	if err != nil {
+		return bettererrors.
+			New("Could not write report").
+			With(bettererrors.NewFromErr(err)).
+			SetContext("filename", filename)
+	}
+
+	return nil
+}
+
+func writeJSONReport(out io.Writer, results []MatchResult) error {
+	data, err := json.MarshalIndent(results, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(append(data, '\n'))
+	return err
+}
+
+func writeCSVReport(out io.Writer, results []MatchResult) error {
+	w := csv.NewWriter(out)
+
+	w.Write([]string{
+		"match", "map", "seed", "started_at", "agent_id", "agent_name",
+		"kills", "deaths", "score", "survival_seconds", "error",
+	})
+
+	for _, result := range results {
+
+		// A match failing before its agents were registered still has a row
+		if len(result.Agents) == 0 {
+			w.Write(append(matchColumns(result), "", "", "", "", "", "", result.Error))
+			continue
+		}
+
+		for _, agent := range result.Agents {
+			w.Write(append(matchColumns(result),
+				agent.Id,
+				agent.Name,
+				strconv.Itoa(agent.Kills),
+				strconv.Itoa(agent.Deaths),
+				strconv.Itoa(agent.Score),
+				strconv.FormatFloat(agent.SurvivalSeconds, 'f', 2, 64),
+				result.Error,
+			))
+		}
+	}
+
+	w.Flush()
+
+	return w.Error()
+}
+
+func matchColumns(result MatchResult) []string {
+	return []string{
+		strconv.Itoa(result.Match),
+		result.MapName,
+		strconv.FormatInt(result.Seed, 10),
+		result.StartedAt,
+	}
+}
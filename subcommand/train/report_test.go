@@ -0,0 +1,46 @@
+package train
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"testing"
+)
+
+func TestWriteCSVReport(t *testing.T) {
+	results := []MatchResult{
+		{
+			Match:   1,
+			MapName: "hexagon",
+			Seed:    42,
+			Agents:  []AgentResult{{Id: "a", Name: "A", Kills: 2, Deaths: 1, Score: 2, SurvivalSeconds: 1.5}},
+		},
+		{
+			Match:   2,
+			MapName: "hexagon",
+			Seed:    43,
+			Error:   "agent crashed",
+		},
+	}
+
+	var out bytes.Buffer
+
+	if err := writeCSVReport(&out, results); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]string{
+		{"match", "map", "seed", "started_at", "agent_id", "agent_name", "kills", "deaths", "score", "survival_seconds", "error"},
+		{"1", "hexagon", "42", "", "a", "A", "2", "1", "2", "1.50", ""},
+		{"2", "hexagon", "43", "", "", "", "", "", "", "", "agent crashed"},
+	}
+
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("expected %v, got %v", expected, rows)
+	}
+}
@@ -0,0 +1,142 @@
+package train
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// vizMessage is the subset of the visualization state streamed on every tick
+// that the trainer needs to keep the score of a match.
+type vizMessage struct {
+	Objects []struct {
+		PlayerInfo *struct {
+			IsAlive    bool   `json:"isAlive"`
+			PlayerId   string `json:"playerId"`
+			PlayerName string `json:"playerName"`
+			Score      struct {
+				Value int `json:"value"`
+			} `json:"score"`
+		} `json:"playerInfo"`
+	} `json:"objects"`
+}
+
+type agentStats struct {
+	result     AgentResult
+	ticksAlive int
+	isAlive    bool
+}
+
+// matchStats accumulates per-agent results from the visualization messages
+// of a running match.
+type matchStats struct {
+	mutex  sync.Mutex
+	tps    int
+	ticks  int
+	agents map[string]*agentStats
+	order  []string
+}
+
+func newMatchStats(tps int) *matchStats {
+	return &matchStats{
+		tps:    tps,
+		agents: make(map[string]*agentStats),
+		order:  make([]string, 0),
+	}
+}
+
+func (s *matchStats) Record(data []byte) error {
+	var msg vizMessage
+
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.ticks++
+
+	died := make(map[string]bool)
+	scored := make(map[string]int)
+
+	for _, object := range msg.Objects {
+		info := object.PlayerInfo
+
+		if info == nil {
+			continue
+		}
+
+		stats, ok := s.agents[info.PlayerId]
+
+		if !ok {
+			stats = &agentStats{
+				result: AgentResult{
+					Id:    info.PlayerId,
+					Name:  info.PlayerName,
+					Score: info.Score.Value,
+				},
+				isAlive: true,
+			}
+
+			s.agents[info.PlayerId] = stats
+			s.order = append(s.order, info.PlayerId)
+		}
+
+		if stats.isAlive && !info.IsAlive {
+			stats.result.Deaths++
+			died[info.PlayerId] = true
+		}
+
+		if delta := info.Score.Value - stats.result.Score; delta > 0 {
+			scored[info.PlayerId] = delta
+		}
+
+		if info.IsAlive {
+			stats.ticksAlive++
+		}
+
+		stats.isAlive = info.IsAlive
+		stats.result.Score = info.Score.Value
+	}
+
+	s.recordKills(died, scored)
+
+	return nil
+}
+
+// recordKills credits the deaths of a tick to the agents that scored during
+// it; points scored while nobody else died are not kills.
+func (s *matchStats) recordKills(died map[string]bool, scored map[string]int) {
+	for id, delta := range scored {
+		victims := len(died)
+		if died[id] {
+			victims--
+		}
+
+		if delta > victims {
+			delta = victims
+		}
+
+		s.agents[id].result.Kills += delta
+	}
+}
+
+func (s *matchStats) Results() []AgentResult {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	results := make([]AgentResult, 0)
+
+	for _, id := range s.order {
+		stats := s.agents[id]
+		result := stats.result
+
+		if s.tps > 0 {
+			result.SurvivalSeconds = float64(stats.ticksAlive) / float64(s.tps)
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
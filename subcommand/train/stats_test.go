@@ -0,0 +1,54 @@
+package train
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// vizTick is the visualization message of a tick; each player is given as
+// id:alive:score.
+func vizTick(players ...string) []byte {
+	objects := make([]string, 0)
+
+	for _, player := range players {
+		fields := strings.Split(player, ":")
+		id, alive, score := fields[0], fields[1] == "alive", fields[2]
+
+		objects = append(objects, fmt.Sprintf(`{"playerInfo": {"isAlive": %v, "playerId": "%s", "playerName": "%s", "score": {"value": %s}}}`, alive, id, id, score))
+	}
+
+	return []byte(`{"objects": [` + strings.Join(objects, ",") + `]}`)
+}
+
+func TestMatchStatsKills(t *testing.T) {
+	stats := newMatchStats(10)
+
+	ticks := [][]byte{
+		vizTick("a:alive:0", "b:alive:0", "c:alive:0"),
+		// a kills b
+		vizTick("a:alive:1", "b:dead:0", "c:alive:0"),
+		// c scores without a death
+		vizTick("a:alive:1", "b:dead:0", "c:alive:1"),
+		// b respawns; a kills c
+		vizTick("a:alive:2", "b:alive:0", "c:dead:1"),
+	}
+
+	for _, tick := range ticks {
+		if err := stats.Record(tick); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := map[string][2]int{
+		"a": {2, 0},
+		"b": {0, 1},
+		"c": {0, 1},
+	}
+
+	for _, result := range stats.Results() {
+		if actual := [2]int{result.Kills, result.Deaths}; actual != expected[result.Id] {
+			t.Errorf("%s: expected kills and deaths %v, got %v", result.Id, expected[result.Id], actual)
+		}
+	}
+}
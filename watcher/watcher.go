@@ -3,10 +3,13 @@ package watcher
 import (
 	"fmt"
 	"io/ioutil"
-	"path"
+	"os"
+	"path/filepath"
 
 	"github.com/fsnotify/fsnotify"
 	bettererrors "github.com/xtuc/better-errors"
+
+	"github.com/bytearena/ba/ignore"
 )
 
 var (
@@ -36,12 +39,61 @@ func MakeWatcher() (Watcher, error) {
 	}, nil
 }
 
-func (w Watcher) Add(dir string) {
+// Add watches dir and its subdirectories; its changes are then sent on
+// Wait.
+func (w Watcher) Add(dir string) error {
+	// Events are named after the watched paths; they are compared to the
+	// ignore rules of the directory
+	absdir, err := filepath.Abs(dir)
+
+	if err != nil {
+		return bettererrors.NewFromErr(err)
+	}
+
+	// Files left out of the build context don't trigger builds
+	matcher, err := ignore.Load(absdir)
+
+	if err != nil {
+		return err
+	}
+
+	err = w.fsnotifyWatcher.Add(absdir)
+
+	if err != nil {
+		return bettererrors.NewFromErr(err)
+	}
+
+	err = addDirWatchers(w.fsnotifyWatcher, absdir, 0, matcher)
+
+	if err != nil {
+		return err
+	}
+
 	go func() {
 		for {
 			select {
 			case event := <-w.fsnotifyWatcher.Events:
 
+				// New rules may also bring back directories that were not
+				// watched
+				if isIgnoreFile(absdir, event.Name) {
+					reloaded, err := ignore.Load(absdir)
+
+					if err != nil {
+						fmt.Fprintln(os.Stderr, "Could not reload ignore rules, keeping the previous ones: "+err.Error())
+					} else {
+						matcher = reloaded
+
+						if err := addDirWatchers(w.fsnotifyWatcher, absdir, 0, matcher); err != nil {
+							fmt.Fprintln(os.Stderr, "Could not watch "+absdir+": "+err.Error())
+						}
+					}
+				}
+
+				if matcher.IsIgnored(event.Name) {
+					continue
+				}
+
 				if event.Op&fsnotify.Write == fsnotify.Write ||
 					event.Op&fsnotify.Create == fsnotify.Create ||
 					event.Op&fsnotify.Remove == fsnotify.Remove {
@@ -49,7 +101,7 @@ func (w Watcher) Add(dir string) {
 					select {
 					case w.notify <- nil: // ok
 					default:
-						fmt.Println("Already building ignoring")
+						fmt.Fprintln(os.Stderr, "Already building ignoring")
 					}
 				}
 			case err := <-w.fsnotifyWatcher.Errors:
@@ -59,25 +111,14 @@ func (w Watcher) Add(dir string) {
 		}
 	}()
 
-	err := w.fsnotifyWatcher.Add(dir)
-
-	if err != nil {
-		w.notify <- bettererrors.NewFromErr(err)
-		return
-	}
-
-	err = addDirWatchers(w.fsnotifyWatcher, dir, 0)
-
-	if err != nil {
-		w.notify <- err
-	}
+	return nil
 }
 
 func (w Watcher) Close() error {
 	return w.fsnotifyWatcher.Close()
 }
 
-func addDirWatchers(watcher *fsnotify.Watcher, dir string, depth uint) error {
+func addDirWatchers(watcher *fsnotify.Watcher, dir string, depth uint, matcher *ignore.Matcher) error {
 	files, err := ioutil.ReadDir(dir)
 
 	if err != nil {
@@ -92,7 +133,11 @@ func addDirWatchers(watcher *fsnotify.Watcher, dir string, depth uint) error {
 				continue
 			}
 
-			absName := path.Join(dir, file.Name())
+			absName := filepath.Join(dir, file.Name())
+
+			if matcher.CanSkipDir(absName) {
+				continue
+			}
 
 			err := watcher.Add(absName)
 
@@ -101,7 +146,7 @@ func addDirWatchers(watcher *fsnotify.Watcher, dir string, depth uint) error {
 			}
 
 			if depth < WATCH_DIR_RECURSION_DEPTH {
-				err := addDirWatchers(watcher, absName, depth+1)
+				err := addDirWatchers(watcher, absName, depth+1, matcher)
 
 				if err != nil {
 					return err
@@ -113,6 +158,21 @@ func addDirWatchers(watcher *fsnotify.Watcher, dir string, depth uint) error {
 	return nil
 }
 
+// isIgnoreFile tells whether path is one of the ignore files of dir.
+func isIgnoreFile(dir string, path string) bool {
+	if filepath.Dir(path) != dir {
+		return false
+	}
+
+	for _, filename := range ignore.IGNORE_FILES {
+		if filepath.Base(path) == filename {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (w Watcher) Wait() chan error {
 	return w.notify
 }